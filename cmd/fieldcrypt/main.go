@@ -0,0 +1,142 @@
+// Command fieldcrypt manages the keys that encrypt personal user fields and TOTP secrets at rest.
+//
+// Usage:
+//
+//	go run ./cmd/fieldcrypt genkey    [-id ID]
+//	go run ./cmd/fieldcrypt reencrypt [-batch 500] [-dry-run]
+//
+// A typical rotation is "genkey", adding the printed entry to FIELD_ENCRYPTION_KEYS
+// and naming it in FIELD_ENCRYPTION_ACTIVE_KEY, restarting the server, running
+// "reencrypt", and finally removing the old entry.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"order-notification-system/internal/config"
+	"order-notification-system/internal/fieldcrypt"
+	"order-notification-system/internal/models"
+)
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "genkey":
+		err = runGenkey(args)
+	case "reencrypt":
+		err = runReencrypt(args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: fieldcrypt <genkey|reencrypt> [flags]")
+	fmt.Fprintln(os.Stderr, "run 'fieldcrypt <command> -h' for the flags of a command")
+}
+
+// runGenkey prints a new data-encryption key entry and a new blind index key.
+func runGenkey(args []string) error {
+	fs := flag.NewFlagSet("genkey", flag.ExitOnError)
+	id := fs.String("id", "", "key id (default: date-based)")
+	fs.Parse(args)
+
+	if strings.Contains(*id, ":") || strings.Contains(*id, ",") {
+		return errors.New("key id cannot contain ':' or ','")
+	}
+	key, err := fieldcrypt.NewKey()
+	if err != nil {
+		return err
+	}
+	indexKey, err := fieldcrypt.NewKey()
+	if err != nil {
+		return err
+	}
+	fmt.Println("# Add to FIELD_ENCRYPTION_KEYS (and set FIELD_ENCRYPTION_ACTIVE_KEY to its id to encrypt with it):")
+	fmt.Printf("%s:%s\n", keyID(*id), key)
+	fmt.Println("# BLIND_INDEX_KEY, for a new installation only; changing it requires 'reencrypt':")
+	fmt.Println(indexKey)
+	return nil
+}
+
+// runReencrypt brings every user's personal columns and TOTP secret to the active key and
+// recomputes the blind indexes.
+func runReencrypt(args []string) error {
+	fs := flag.NewFlagSet("reencrypt", flag.ExitOnError)
+	batch := fs.Int("batch", 500, "users read per query")
+	dryRun := fs.Bool("dry-run", false, "only count the users that would be rewritten")
+	fs.Parse(args)
+
+	if *batch <= 0 {
+		return errors.New("-batch must be positive")
+	}
+	db := config.Init()
+	if db == nil {
+		return errors.New("failed to initialize database connection")
+	}
+	if err := models.AutoMigrate(db); err != nil {
+		return fmt.Errorf("failed to migrate database schema: %w", err)
+	}
+	if err := fieldcrypt.Init(); err != nil {
+		return err
+	}
+	active, err := fieldcrypt.ActiveKeyID()
+	if err != nil {
+		return err
+	}
+
+	stats, err := models.ReencryptUsers(db, *batch, *dryRun)
+	if err != nil {
+		return fmt.Errorf("re-encryption stopped after %d users: %w", stats.Scanned, err)
+	}
+	report("users", stats, active, *dryRun)
+
+	stats, err = models.ReencryptTwoFactorSecrets(db, *batch, *dryRun)
+	if err != nil {
+		return fmt.Errorf("re-encryption stopped after %d two-factor secrets: %w", stats.Scanned, err)
+	}
+	report("two-factor secrets", stats, active, *dryRun)
+	return nil
+}
+
+// report prints what a re-encryption pass over the named rows did.
+func report(rows string, stats models.ReencryptStats, active string, dryRun bool) {
+	if dryRun {
+		fmt.Printf("✅ Scanned %d %s; %d would be rewritten with key %s\n", stats.Scanned, rows, stats.Updated, active)
+		return
+	}
+	fmt.Printf("✅ Scanned %d %s; rewrote %d with key %s", stats.Scanned, rows, stats.Updated, active)
+	if stats.Skipped > 0 {
+		fmt.Printf(" (%d changed meanwhile and were left as saved)", stats.Skipped)
+	}
+	fmt.Println()
+}
+
+func keyID(id string) string {
+	if id != "" {
+		return id
+	}
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		log.Fatal(err)
+	}
+	return time.Now().Format("2006-01-02") + "-" + hex.EncodeToString(suffix)
+}
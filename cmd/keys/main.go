@@ -0,0 +1,250 @@
+// Command keys manages the JWT signing keyring read by the server from JWT_KEYRING_FILE.
+//
+// Usage:
+//
+//	go run ./cmd/keys init     [-file keyring.json] [-alg EdDSA] [-kid ID] [-yes]
+//	go run ./cmd/keys generate [-file keyring.json] [-alg EdDSA] [-kid ID] [-activate]
+//	go run ./cmd/keys activate [-file keyring.json] -kid ID
+//	go run ./cmd/keys retire   [-file keyring.json] -kid ID
+//	go run ./cmd/keys list     [-file keyring.json]
+//	go run ./cmd/keys jwks     [-file keyring.json]
+//
+// A typical rotation is "generate -activate" (the old active key keeps
+// verifying), SIGHUP the server, and "retire" the old key once its tokens
+// have expired.
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"order-notification-system/internal/auth"
+)
+
+const defaultKeyringFile = "keyring.json"
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "init":
+		err = runInit(args)
+	case "generate":
+		err = runGenerate(args)
+	case "activate":
+		err = runActivate(args)
+	case "retire":
+		err = runRetire(args)
+	case "list":
+		err = runList(args)
+	case "jwks":
+		err = runJWKS(args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: keys <init|generate|activate|retire|list|jwks> [flags]")
+	fmt.Fprintln(os.Stderr, "run 'keys <command> -h' for the flags of a command")
+}
+
+// runInit creates a new keyring with a single active key.
+func runInit(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	file := fs.String("file", defaultKeyringFile, "keyring file to create")
+	alg := fs.String("alg", auth.AlgEdDSA, "algorithm: HS256, RS256 or EdDSA")
+	kid := fs.String("kid", "", "key id (default: date-based)")
+	bits := fs.Int("bits", 3072, "RSA key size")
+	yes := fs.Bool("yes", false, "overwrite an existing keyring without asking")
+	fs.Parse(args)
+
+	if _, err := os.Stat(*file); err == nil {
+		if !*yes && !confirm(fmt.Sprintf("%s already exists. Overwriting it invalidates every token signed with its keys. Continue?", *file)) {
+			return errors.New("aborted, keyring left unchanged")
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	entry, err := auth.GenerateKeyEntry(keyID(*kid), *alg, auth.KeyStatusActive, *bits)
+	if err != nil {
+		return err
+	}
+	if err := auth.WriteKeyringFile(*file, &auth.KeyringFile{Keys: []auth.KeyEntry{entry}}); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Created %s with active %s key %s\n", *file, entry.Alg, entry.ID)
+	return nil
+}
+
+// runGenerate adds a new key, as a verify key unless -activate is given.
+func runGenerate(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	file := fs.String("file", defaultKeyringFile, "keyring file")
+	alg := fs.String("alg", auth.AlgEdDSA, "algorithm: HS256, RS256 or EdDSA")
+	kid := fs.String("kid", "", "key id (default: date-based)")
+	bits := fs.Int("bits", 3072, "RSA key size")
+	activate := fs.Bool("activate", false, "make the new key the signing key")
+	fs.Parse(args)
+
+	keyring, err := auth.ReadKeyringFile(*file)
+	if err != nil {
+		return err
+	}
+	id := keyID(*kid)
+	if keyring.Find(id) >= 0 {
+		return fmt.Errorf("key %s already exists; refusing to overwrite it", id)
+	}
+
+	entry, err := auth.GenerateKeyEntry(id, *alg, auth.KeyStatusVerify, *bits)
+	if err != nil {
+		return err
+	}
+	keyring.Keys = append(keyring.Keys, entry)
+	if *activate {
+		setActive(keyring, id)
+	}
+	if err := auth.WriteKeyringFile(*file, keyring); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Added %s key %s (%s)\n", entry.Alg, id, keyring.Keys[keyring.Find(id)].Status)
+	return nil
+}
+
+// runActivate makes an existing key the signing key; the previous one keeps verifying.
+func runActivate(args []string) error {
+	fs := flag.NewFlagSet("activate", flag.ExitOnError)
+	file := fs.String("file", defaultKeyringFile, "keyring file")
+	kid := fs.String("kid", "", "key id to activate")
+	fs.Parse(args)
+
+	keyring, err := auth.ReadKeyringFile(*file)
+	if err != nil {
+		return err
+	}
+	i := keyring.Find(*kid)
+	if i < 0 {
+		return fmt.Errorf("key %q not found", *kid)
+	}
+	if keyring.Keys[i].Status == auth.KeyStatusRetired {
+		return fmt.Errorf("key %s is retired and cannot be activated", *kid)
+	}
+	setActive(keyring, *kid)
+	if err := auth.WriteKeyringFile(*file, keyring); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Key %s is now active\n", *kid)
+	return nil
+}
+
+// runRetire stops a key from verifying. The active key cannot be retired.
+func runRetire(args []string) error {
+	fs := flag.NewFlagSet("retire", flag.ExitOnError)
+	file := fs.String("file", defaultKeyringFile, "keyring file")
+	kid := fs.String("kid", "", "key id to retire")
+	fs.Parse(args)
+
+	keyring, err := auth.ReadKeyringFile(*file)
+	if err != nil {
+		return err
+	}
+	i := keyring.Find(*kid)
+	if i < 0 {
+		return fmt.Errorf("key %q not found", *kid)
+	}
+	if keyring.Keys[i].Status == auth.KeyStatusActive {
+		return fmt.Errorf("key %s is active; activate another key first", *kid)
+	}
+	keyring.Keys[i].Status = auth.KeyStatusRetired
+	if err := auth.WriteKeyringFile(*file, keyring); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Key %s retired\n", *kid)
+	return nil
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	file := fs.String("file", defaultKeyringFile, "keyring file")
+	fs.Parse(args)
+
+	keyring, err := auth.ReadKeyringFile(*file)
+	if err != nil {
+		return err
+	}
+	for _, entry := range keyring.Keys {
+		fmt.Printf("%-28s %-6s %s\n", entry.ID, entry.Alg, entry.Status)
+	}
+	return nil
+}
+
+func runJWKS(args []string) error {
+	fs := flag.NewFlagSet("jwks", flag.ExitOnError)
+	file := fs.String("file", defaultKeyringFile, "keyring file")
+	fs.Parse(args)
+
+	keyring, err := auth.ReadKeyringFile(*file)
+	if err != nil {
+		return err
+	}
+	set, err := keyring.JWKS()
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// setActive marks kid active and demotes the previously active key to verify.
+func setActive(keyring *auth.KeyringFile, kid string) {
+	for i := range keyring.Keys {
+		switch {
+		case keyring.Keys[i].ID == kid:
+			keyring.Keys[i].Status = auth.KeyStatusActive
+		case keyring.Keys[i].Status == auth.KeyStatusActive:
+			keyring.Keys[i].Status = auth.KeyStatusVerify
+		}
+	}
+}
+
+// keyID returns kid, or a date-based id with a random suffix when kid is empty.
+func keyID(kid string) string {
+	if kid != "" {
+		return kid
+	}
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		log.Fatal(err)
+	}
+	return time.Now().Format("2006-01-02") + "-" + hex.EncodeToString(suffix)
+}
+
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -9,8 +9,12 @@ import (
 	"syscall"
 	"time"
 
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/auth"
 	"order-notification-system/internal/config"
+	"order-notification-system/internal/fieldcrypt"
 	"order-notification-system/internal/middleware" // Added import for middleware
+	"order-notification-system/internal/models"
 	"order-notification-system/internal/routes"
 
 	"github.com/gin-gonic/gin"
@@ -21,14 +25,46 @@ func main() {
 	if db == nil {
 		log.Fatalf("Failed to initialize database connection")
 	}
+	if err := models.AutoMigrate(db); err != nil {
+		log.Fatalf("Failed to migrate database schema: %v", err)
+	}
+	if err := auth.InitBreachedList(); err != nil {
+		log.Fatalf("Failed to open breached password list: %v", err)
+	}
+	if err := fieldcrypt.Init(); err != nil {
+		log.Fatalf("Failed to load field encryption keys: %v", err)
+	}
+	if err := auth.InitKeyring(); err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+	// Reload the keyring on SIGHUP so a new key can start signing without a restart
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := auth.InitKeyring(); err != nil {
+				log.Printf("Failed to reload JWT signing keys, keeping the current keyring: %v", err)
+				continue
+			}
+			log.Println("JWT signing keys reloaded")
+		}
+	}()
+	if _, err := auth.InitRevocationStore(db); err != nil {
+		log.Fatalf("Failed to load token revocations: %v", err)
+	}
+	auth.InitAPIKeyStore(db)
 
 	gin.SetMode(gin.ReleaseMode)
 	// Initialize Gin router with Logger and Recovery middleware
 	r := gin.New()
-	r.Use(gin.Logger())
-	r.Use(gin.Recovery())
+	r.Use(middleware.RedactedLogger()) // gin.Logger with token/ticket query values masked
+	// Recover from panics with a problem+json 500; gin logs the panic and stack trace
+	r.Use(gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		apierror.Respond(c, apierror.Internal("The server could not complete the request"))
+	}))
 
 	r.Use(middleware.CORSMiddleware()) // Use CORSMiddleware from middleware package
+	r.Use(middleware.Language())       // Accept-Language, overridden by the user's saved preference
 
 	routes.SetupRouter(r, db)
 
@@ -3,9 +3,14 @@ package api
 import (
 	"errors"
 	"net/http"
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/i18n"
+	"order-notification-system/internal/middleware"
 	"order-notification-system/internal/models"
 	"order-notification-system/internal/utils"
+	"order-notification-system/internal/validation"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -19,48 +24,90 @@ func NewOrderAPI(db *gorm.DB) *OrderAPI {
 	return &OrderAPI{DB: db}
 }
 
+// CreateOrderRequest is the body of POST /order.
+type CreateOrderRequest struct {
+	ItemCode string  `json:"item_code" binding:"required,max=10"`
+	Item     string  `json:"item" binding:"required,notblank,max=100"`
+	Quantity int     `json:"quantity" binding:"required,gt=0,lte=1000"`
+	Price    float64 `json:"price" binding:"required,gt=0"`
+	Image    string  `json:"image" binding:"max=500"`
+}
+
 func (api *OrderAPI) CreateOrder(c *gin.Context) {
-	var order models.Order
+	var req CreateOrderRequest
 
 	// Decode the incoming order request
-	if err := c.ShouldBindJSON(&order); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+	if !validation.BindJSON(c, &req) {
 		return
 	}
+	order := models.Order{
+		ItemCode: req.ItemCode,
+		Item:     req.Item,
+		Quantity: req.Quantity,
+		Price:    req.Price,
+		Image:    req.Image,
+	}
+
+	// Link the order to the logged-in customer, if any, so they get inbox notifications.
+	// Orders placed with an API key (e.g. from a POS terminal) have no owner.
+	order.Username = ""
+	if claims, ok := middleware.GetClaims(c); ok && !claims.IsAPIKey() {
+		order.Username = claims.Username
+	}
 
 	if err := models.CreateOrder(api.DB, &order); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order", "details": err.Error()})
+		apierror.Respond(c, apierror.FromDB(err, nil, "Failed to create order"))
 		return
 	}
 
-	utils.NotifyNewOrder(strconv.FormatUint(uint64(order.ID), 10), order.ItemCode, order.Item, order.Quantity)
+	utils.NotifyNewOrder(&order)
 
 	// ตอบกลับด้วยข้อมูลที่บันทึกสำเร็จ
 	c.JSON(http.StatusCreated, order)
 }
 
+// UpdateOrderStatus moves an order to a new status. Completed and cancelled orders are final;
+// setting the status an order already has succeeds without notifying anyone.
 func (api *OrderAPI) UpdateOrderStatus(c *gin.Context) {
 	orderID := c.Param("id")
+	id, err := strconv.ParseUint(orderID, 10, 32)
+	if err != nil || id == 0 {
+		apierror.Respond(c, apierror.BadRequest("Order ID must be a positive integer"))
+		return
+	}
 	var payload struct {
-		Status string `json:"status"`
+		Status string `json:"status" binding:"required,oneof=pending preparing ready completed cancelled"`
 	}
 
-	if err := c.ShouldBindJSON(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload", "details": err.Error()})
+	if !validation.BindJSON(c, &payload) {
 		return
 	}
 
-	if err := models.UpdateOrderStatus(api.DB, orderID, payload.Status); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status", "details": err.Error()})
+	order, previousStatus, err := models.UpdateOrderStatus(api.DB, uint(id), payload.Status)
+	if errors.Is(err, models.ErrInvalidTransition) {
+		apierror.Respond(c, apierror.New(http.StatusConflict, apierror.CodeInvalidTransition, "").
+			WithDetail("Order %s is %s and cannot become %s", orderID, previousStatus, payload.Status).
+			With("current_status", previousStatus))
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrOrderNotFound.With("order_id", orderID), "Failed to update order status"))
+		return
+	}
+	if previousStatus == order.Status {
+		c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "Order status updated successfully"), "order": order})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Order status updated successfully"})
+	utils.NotifyOrderStatus(order, previousStatus)
+	utils.NotifyOrderOwner(api.DB, order, previousStatus)
+
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(c, "Order status updated successfully"), "order": order})
 }
 
 // GetProductRequest defines the expected request body for fetching a product.
 type GetProductRequest struct {
-	ProductID string `json:"product_id" binding:"required"`
+	ProductID string `json:"product_id" binding:"required,max=10"`
 }
 
 // GetProduct handles fetching a product by its ID.
@@ -69,24 +116,22 @@ func (api *OrderAPI) GetProduct(c *gin.Context) {
 	var req GetProductRequest
 	var product models.Product
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+	if !validation.BindJSON(c, &req) {
 		return
 	}
 
-	// req.ProductID is already validated by `binding:"required"`
-
 	err := models.GetProductByID(api.DB, &product, req.ProductID)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found", "product_id": req.ProductID})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve product", "details": err.Error()})
-		}
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrProductNotFound.With("product_id", req.ProductID), "Failed to retrieve product"))
 		return
 	}
 
-	c.JSON(http.StatusOK, product)
+	products := []models.Product{product}
+	if err := models.LocalizeProducts(api.DB, products, i18n.FromContext(c)); err != nil {
+		apierror.Respond(c, apierror.Internal("Failed to retrieve product").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, products[0])
 }
 
 // GetProducts handles fetching all products.
@@ -95,7 +140,7 @@ func (api *OrderAPI) GetProducts(c *gin.Context) {
 
 	err := models.GetAllProducts(api.DB, &products)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products", "details": err.Error()})
+		apierror.Respond(c, apierror.FromDB(err, nil, "Failed to retrieve products"))
 		return
 	}
 
@@ -103,29 +148,110 @@ func (api *OrderAPI) GetProducts(c *gin.Context) {
 		c.JSON(http.StatusOK, []models.Product{}) // Return empty array if no products found
 		return
 	}
+	if err := models.LocalizeProducts(api.DB, products, i18n.FromContext(c)); err != nil {
+		apierror.Respond(c, apierror.Internal("Failed to retrieve products").Wrap(err))
+		return
+	}
 	c.JSON(http.StatusOK, products)
 }
 
+// CreateProductRequest is the body of POST /api/editproduct. The limits follow the product columns.
+type CreateProductRequest struct {
+	ProductID   string  `json:"product_id" binding:"required,notblank,max=10"`
+	Name        string  `json:"name" binding:"required,notblank,max=100"`
+	Price       float64 `json:"price" binding:"required,gt=0,lt=100000000"`
+	Category    *string `json:"category" binding:"omitnil,max=50"`
+	Description *string `json:"description" binding:"omitnil,max=2000"`
+	ImageURL    *string `json:"image_url" binding:"omitnil,url,max=255"`
+	Status      string  `json:"status" binding:"omitempty,oneof=active inactive"`
+	// Translations of the name and description, keyed by language, e.g. {"th": {"name": "..."}}
+	Translations map[string]ProductTranslationRequest `json:"translations" binding:"omitempty,dive,keys,language,endkeys,required"`
+}
+
+// ProductTranslationRequest is the name and description of a product in one language.
+type ProductTranslationRequest struct {
+	Name        string  `json:"name" binding:"required,notblank,max=100"`
+	Description *string `json:"description" binding:"omitnil,max=2000"`
+}
+
 // CreateProduct handles the creation of a new product.
 // The route is POST /editproduct, which is a bit unconventional for creation.
 func (api *OrderAPI) CreateProduct(c *gin.Context) {
-	var product models.Product
+	var req CreateProductRequest
 
-	if err := c.ShouldBindJSON(&product); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body for creating product", "details": err.Error()})
+	if !validation.BindJSON(c, &req) {
 		return
 	}
+	product := models.Product{
+		ProductID:   req.ProductID,
+		Name:        req.Name,
+		Price:       req.Price,
+		Category:    req.Category,
+		Description: req.Description,
+		ImageURL:    req.ImageURL,
+		Status:      req.Status,
+	}
 
-	// Basic validation can be expanded here (e.g., checking required fields not covered by GORM `not null`)
-	if product.ProductID == "" || product.Name == "" || product.Price <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "product_id, name are required, and price must be positive"})
-		return
+	translations := make([]models.ProductTranslation, 0, len(req.Translations))
+	for language, translation := range req.Translations {
+		translations = append(translations, models.ProductTranslation{
+			Language:    language,
+			Name:        translation.Name,
+			Description: translation.Description,
+		})
 	}
 
-	if err := models.CreateProduct(api.DB, &product); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product", "details": err.Error()})
+	if err := models.CreateProduct(api.DB, &product, translations...); err != nil {
+		if apierror.IsUniqueViolation(err) {
+			validation.RespondField(c, "product_id", "unique", "is already taken")
+			return
+		}
+		apierror.Respond(c, apierror.FromDB(err, nil, "Failed to create product"))
 		return
 	}
 
 	c.JSON(http.StatusCreated, product)
 }
+
+// SaveProductTranslation creates or replaces the translation of a product into the :lang language.
+func (api *OrderAPI) SaveProductTranslation(c *gin.Context) {
+	productID, language := c.Param("id"), c.Param("lang")
+	if !i18n.IsSupported(language) {
+		validation.RespondField(c, "lang", "language", "must be one of: %s", strings.Join(i18n.Supported(), ", "))
+		return
+	}
+	var req ProductTranslationRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+
+	var product models.Product
+	if err := models.GetProductByID(api.DB, &product, productID); err != nil {
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrProductNotFound.With("product_id", productID), "Failed to retrieve product"))
+		return
+	}
+	translation := models.ProductTranslation{
+		ProductID:   productID,
+		Language:    language,
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if err := models.SaveProductTranslation(api.DB, &translation); err != nil {
+		apierror.Respond(c, apierror.FromDB(err, nil, "Failed to save product translation"))
+		return
+	}
+
+	c.JSON(http.StatusOK, translation)
+}
+
+// DeleteProductTranslation removes the translation of a product into the :lang language.
+func (api *OrderAPI) DeleteProductTranslation(c *gin.Context) {
+	productID, language := c.Param("id"), c.Param("lang")
+	if err := models.DeleteProductTranslation(api.DB, productID, language); err != nil {
+		notFound := apierror.ErrNotFound.WithDetail("Product %s has no %s translation", productID, language)
+		apierror.Respond(c, apierror.FromDB(err, notFound, "Failed to delete product translation"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "Translation deleted")})
+}
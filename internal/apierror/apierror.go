@@ -0,0 +1,177 @@
+// Package apierror defines the error type handlers return to clients and writes it
+// as an RFC 7807 problem (application/problem+json) with a stable, machine-readable code.
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"order-notification-system/internal/config"
+	"order-notification-system/internal/i18n"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// ContentType is the media type of every error response.
+const ContentType = "application/problem+json"
+
+// Error is an error that can be shown to a client. Detail is safe to return and is
+// translated into the request's language; Cause holds the internal error, which is logged and never sent.
+type Error struct {
+	Status int
+	Code   Code
+	// Detail is an English message, used as a format string when Args is not empty
+	Detail string
+	Args   []interface{}
+	Cause  error
+	// Extensions are extra members of the problem document, e.g. "errors" or "retry_after"
+	Extensions map[string]interface{}
+}
+
+// New creates an error with the given HTTP status, code and client-facing detail.
+func New(status int, code Code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// Internal creates a 500 error whose detail says what failed, without the cause.
+func Internal(detail string) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, detail)
+}
+
+func (e *Error) Error() string {
+	detail := i18n.Translate(i18n.English, e.Detail, e.Args...)
+	if e.Cause != nil {
+		return string(e.Code) + ": " + detail + ": " + e.Cause.Error()
+	}
+	return string(e.Code) + ": " + detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Wrap returns a copy of e with cause attached for the server log.
+func (e *Error) Wrap(cause error) *Error {
+	copied := e.clone()
+	copied.Cause = cause
+	return copied
+}
+
+// With returns a copy of e with an extra member in the problem document.
+func (e *Error) With(key string, value interface{}) *Error {
+	copied := e.clone()
+	copied.Extensions = make(map[string]interface{}, len(e.Extensions)+1)
+	for k, v := range e.Extensions {
+		copied.Extensions[k] = v
+	}
+	copied.Extensions[key] = value
+	return copied
+}
+
+// WithDetail returns a copy of e with a different detail, formatted with args,
+// e.g. one naming the offending value.
+func (e *Error) WithDetail(detail string, args ...interface{}) *Error {
+	copied := e.clone()
+	copied.Detail = detail
+	copied.Args = args
+	return copied
+}
+
+func (e *Error) clone() *Error {
+	copied := *e
+	return &copied
+}
+
+// FromDB maps a database error to a client error: a missing record becomes notFound,
+// a unique violation 409 ALREADY_EXISTS, a foreign key violation 409 CONFLICT and
+// a check violation 422 VALIDATION_FAILED. Anything else is a 500 with failure as its detail.
+// The original error is kept as the cause.
+func FromDB(err error, notFound *Error, failure string) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var mapped *Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound) && notFound != nil:
+		mapped = notFound
+	case errors.Is(err, gorm.ErrDuplicatedKey) || pgCode(err) == "23505":
+		mapped = ErrAlreadyExists
+	case errors.Is(err, gorm.ErrForeignKeyViolated) || pgCode(err) == "23503":
+		mapped = ErrConflict
+	case errors.Is(err, gorm.ErrCheckConstraintViolated) || pgCode(err) == "23514":
+		mapped = New(http.StatusUnprocessableEntity, CodeValidationFailed, "The request breaks a data constraint")
+	default:
+		mapped = Internal(failure)
+	}
+	return mapped.Wrap(err)
+}
+
+// IsUniqueViolation reports whether err is a unique constraint violation.
+func IsUniqueViolation(err error) bool {
+	return errors.Is(err, gorm.ErrDuplicatedKey) || pgCode(err) == "23505"
+}
+
+func pgCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// typeURI returns the problem type for code: PROBLEM_TYPE_BASE_URL followed by the code
+// in kebab case, or about:blank when no base URL is configured.
+func typeURI(code Code) string {
+	base := config.GetEnv("PROBLEM_TYPE_BASE_URL", "")
+	if base == "" {
+		return "about:blank"
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.ReplaceAll(strings.ToLower(string(code)), "_", "-")
+}
+
+// Problem returns the RFC 7807 document for e at instance (the request path), with the
+// title and detail in language. Extensions become extra members; they never replace the standard ones.
+func (e *Error) Problem(instance, language string) map[string]interface{} {
+	body := make(map[string]interface{}, len(e.Extensions)+6)
+	for k, v := range e.Extensions {
+		body[k] = v
+	}
+	body["type"] = typeURI(e.Code)
+	body["title"] = i18n.Translate(language, http.StatusText(e.Status))
+	body["status"] = e.Status
+	body["code"] = e.Code
+	if e.Detail != "" {
+		body["detail"] = i18n.Translate(language, e.Detail, e.Args...)
+	}
+	if instance != "" {
+		body["instance"] = instance
+	}
+	return body
+}
+
+// Respond aborts the request with err as a problem document. Errors that are not an *Error
+// go through FromDB, so unexpected errors become a generic 500. Causes are logged, never sent.
+func Respond(c *gin.Context, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = FromDB(err, ErrNotFound, "The server could not complete the request")
+	}
+	if apiErr.Cause != nil && !errors.Is(apiErr.Cause, gorm.ErrRecordNotFound) {
+		log.Printf("ERROR code=%s status=%d method=%s path=%q: %v",
+			apiErr.Code, apiErr.Status, c.Request.Method, c.Request.URL.Path, apiErr.Cause)
+	}
+	body, marshalErr := json.Marshal(apiErr.Problem(c.Request.URL.Path, i18n.FromContext(c)))
+	if marshalErr != nil {
+		log.Printf("ERROR failed to encode problem %s: %v", apiErr.Code, marshalErr)
+		body = []byte(`{"type":"about:blank","title":"Internal Server Error","status":500,"code":"INTERNAL_ERROR"}`)
+		apiErr = Internal("")
+	}
+	c.Abort()
+	c.Data(apiErr.Status, ContentType+"; charset=utf-8", body)
+}
@@ -0,0 +1,72 @@
+package apierror
+
+import "net/http"
+
+// Code identifies an error for clients. Codes are part of the API: once published,
+// a code keeps its meaning, and new situations get new codes.
+type Code string
+
+// Generic codes.
+const (
+	CodeBadRequest       Code = "BAD_REQUEST"       // the request cannot be processed as sent, e.g. the body is not JSON
+	CodeValidationFailed Code = "VALIDATION_FAILED" // see the "errors" member for the fields
+	CodeNotFound         Code = "NOT_FOUND"
+	CodeAlreadyExists    Code = "ALREADY_EXISTS" // a unique value is taken
+	CodeConflict         Code = "CONFLICT"       // the change conflicts with the current state
+	CodeRateLimited      Code = "RATE_LIMITED"   // see the Retry-After header
+	CodeUnavailable      Code = "SERVICE_UNAVAILABLE"
+	CodeInternal         Code = "INTERNAL_ERROR"
+)
+
+// Authentication and authorization codes.
+const (
+	CodeUnauthenticated     Code = "UNAUTHENTICATED" // no credentials were sent
+	CodeInvalidToken        Code = "INVALID_TOKEN"   // the access token, refresh token or link is invalid or expired
+	CodeInvalidAPIKey       Code = "INVALID_API_KEY"
+	CodeInvalidCredentials  Code = "INVALID_CREDENTIALS"
+	CodeInvalidSecondFactor Code = "INVALID_SECOND_FACTOR"
+	CodeTwoFactorRequired   Code = "TWO_FACTOR_REQUIRED"
+	CodeForbidden           Code = "FORBIDDEN"
+	CodeAccountSuspended    Code = "ACCOUNT_SUSPENDED"
+	CodeEmailNotVerified    Code = "EMAIL_NOT_VERIFIED"
+	CodeNotForAPIKeys       Code = "NOT_FOR_API_KEYS" // the endpoint needs a user session
+)
+
+// Resource codes.
+const (
+	CodeUserNotFound         Code = "USER_NOT_FOUND"
+	CodeOrderNotFound        Code = "ORDER_NOT_FOUND"
+	CodeProductNotFound      Code = "PRODUCT_NOT_FOUND"
+	CodeNotificationNotFound Code = "NOTIFICATION_NOT_FOUND"
+	CodeAnnouncementNotFound Code = "ANNOUNCEMENT_NOT_FOUND"
+	CodeAPIKeyNotFound       Code = "API_KEY_NOT_FOUND"
+	CodeInvalidTransition    Code = "INVALID_TRANSITION" // the order cannot move to the requested status
+	CodeUserErased           Code = "USER_ERASED"        // the account was anonymized and cannot change
+)
+
+// Errors used by several handlers.
+var (
+	ErrNotFound      = New(http.StatusNotFound, CodeNotFound, "The resource was not found")
+	ErrAlreadyExists = New(http.StatusConflict, CodeAlreadyExists, "A resource with the same unique value already exists")
+	ErrConflict      = New(http.StatusConflict, CodeConflict, "The request conflicts with the current state of the resource")
+
+	ErrUnauthenticated  = New(http.StatusUnauthorized, CodeUnauthenticated, "Authentication is required")
+	ErrInvalidToken     = New(http.StatusUnauthorized, CodeInvalidToken, "Invalid or expired token")
+	ErrInvalidAPIKey    = New(http.StatusUnauthorized, CodeInvalidAPIKey, "Invalid or expired API key")
+	ErrForbidden        = New(http.StatusForbidden, CodeForbidden, "You do not have permission to perform this action")
+	ErrAccountSuspended = New(http.StatusForbidden, CodeAccountSuspended, "Account is suspended")
+	ErrNotForAPIKeys    = New(http.StatusForbidden, CodeNotForAPIKeys, "API keys cannot use this endpoint")
+
+	ErrUserNotFound         = New(http.StatusNotFound, CodeUserNotFound, "User not found")
+	ErrOrderNotFound        = New(http.StatusNotFound, CodeOrderNotFound, "Order not found")
+	ErrProductNotFound      = New(http.StatusNotFound, CodeProductNotFound, "Product not found")
+	ErrNotificationNotFound = New(http.StatusNotFound, CodeNotificationNotFound, "Notification not found")
+	ErrAnnouncementNotFound = New(http.StatusNotFound, CodeAnnouncementNotFound, "Announcement not found")
+	ErrAPIKeyNotFound       = New(http.StatusNotFound, CodeAPIKeyNotFound, "API key not found")
+	ErrUserErased           = New(http.StatusConflict, CodeUserErased, "The account has been erased")
+)
+
+// BadRequest is a 400 with the given detail, formatted with args, for input problems that are not about one field.
+func BadRequest(detail string, args ...interface{}) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, detail).WithDetail(detail, args...)
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"order-notification-system/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to recognise and scan for.
+const APIKeyPrefix = "ons_"
+
+// apiKeyTouchInterval limits how often last-used tracking writes to the database for a busy key.
+const apiKeyTouchInterval = time.Minute
+
+// ErrAPIKeyInvalid is returned for an unknown, revoked or expired API key, or one used from a disallowed IP.
+var ErrAPIKeyInvalid = errors.New("API key is invalid")
+
+// NewAPIKey returns a new raw API key, its display prefix and the hash to store.
+func NewAPIKey() (string, string, string, error) {
+	secret, err := randomString(32)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	raw := APIKeyPrefix + secret
+	return raw, raw[:len(APIKeyPrefix)+8], HashOpaqueToken(raw), nil
+}
+
+// APIKeyUsername is the username API key callers carry in their claims.
+// The colon keeps it apart from real usernames in logs and connection limits.
+func APIKeyUsername(prefix string) string {
+	return "apikey:" + prefix
+}
+
+// ParseIPAllowlist validates a list of IPs and CIDR ranges and returns them normalized.
+func ParseIPAllowlist(entries []string) ([]string, error) {
+	normalized := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			normalized = append(normalized, network.String())
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address or CIDR range %q", entry)
+		}
+		normalized = append(normalized, ip.String())
+	}
+	return normalized, nil
+}
+
+// ipAllowed reports whether ip matches the comma-separated allowlist. An empty list allows every address.
+func ipAllowed(allowlist string, ip string) bool {
+	if strings.TrimSpace(allowlist) == "" {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range strings.Split(allowlist, ",") {
+		entry = strings.TrimSpace(entry)
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyStore authenticates API keys against the database.
+type APIKeyStore struct {
+	db *gorm.DB
+}
+
+// apiKeys is the store used by the auth middleware; nil until InitAPIKeyStore is called.
+var apiKeys *APIKeyStore
+
+// InitAPIKeyStore sets up the store used to authenticate API keys.
+func InitAPIKeyStore(db *gorm.DB) *APIKeyStore {
+	apiKeys = &APIKeyStore{db: db}
+	return apiKeys
+}
+
+// APIKeys returns the store initialized by InitAPIKeyStore.
+func APIKeys() *APIKeyStore {
+	return apiKeys
+}
+
+// Authenticate checks a raw API key presented from ip and returns claims that carry the key's
+// role and scopes. It returns ErrAPIKeyInvalid for keys that are unknown, revoked, expired or
+// used from an address outside their allowlist.
+func (s *APIKeyStore) Authenticate(raw string, ip string) (*CustomClaims, error) {
+	if !strings.HasPrefix(raw, APIKeyPrefix) {
+		return nil, ErrAPIKeyInvalid
+	}
+	key, err := models.GetAPIKeyByHash(s.db, HashOpaqueToken(raw))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !usable(key, ip, now) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval || key.LastUsedIP != ip {
+		if err := models.TouchAPIKey(s.db, key.ID, ip, now); err != nil {
+			log.Printf("Error recording use of API key %s: %v", key.Prefix, err)
+		}
+	}
+
+	claims := &CustomClaims{
+		Username: APIKeyUsername(key.Prefix),
+		Role:     NormalizeRole(key.Role),
+		APIKeyID: key.ID,
+	}
+	for _, scope := range strings.Split(key.Scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			claims.Scopes = append(claims.Scopes, Permission(scope))
+		}
+	}
+	return claims, nil
+}
+
+// Check returns ErrAPIKeyInvalid if the key with id has been revoked or has expired since its
+// claims were issued, or may not be used from ip. Credentials derived from an API key, such as
+// a WebSocket ticket, are checked with it when they are redeemed.
+func (s *APIKeyStore) Check(id uint, ip string) error {
+	key, err := models.GetAPIKeyByID(s.db, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if !usable(key, ip, time.Now()) {
+		return ErrAPIKeyInvalid
+	}
+	return nil
+}
+
+// usable reports whether key is neither revoked nor expired at now and may be used from ip.
+func usable(key *models.APIKey, ip string, now time.Time) bool {
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return false
+	}
+	if !ipAllowed(key.AllowedIPs, ip) {
+		log.Printf("SECURITY event=api_key_ip_denied key=%s ip=%s", key.Prefix, ip)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrVerificationTokenInvalid is returned for a malformed, tampered or expired verification token.
+var ErrVerificationTokenInvalid = errors.New("email verification token is invalid or expired")
+
+type emailVerificationPayload struct {
+	Username  string `json:"u"`
+	Email     string `json:"e"`
+	ExpiresAt int64  `json:"x"`
+}
+
+// emailVerificationSecret is EMAIL_VERIFICATION_SECRET, falling back to JWT_SECRET_KEY.
+// It is separate from the JWT keyring so a verification link can never pass as an access token.
+func emailVerificationSecret() ([]byte, error) {
+	secret := os.Getenv("EMAIL_VERIFICATION_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET_KEY")
+	}
+	if secret == "" {
+		return nil, errors.New("EMAIL_VERIFICATION_SECRET (or JWT_SECRET_KEY) is not set")
+	}
+	return []byte(secret), nil
+}
+
+// NewEmailVerificationToken returns a signed token proving control of email for username.
+// It is bound to the email, so changing the address invalidates links sent for the old one.
+func NewEmailVerificationToken(username, email string, ttl time.Duration) (string, error) {
+	secret, err := emailVerificationSecret()
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(emailVerificationPayload{
+		Username:  username,
+		Email:     strings.ToLower(email),
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + signVerification(secret, encoded), nil
+}
+
+// ParseEmailVerificationToken checks the signature and expiry and returns the username and email it was issued for.
+func ParseEmailVerificationToken(token string) (string, string, error) {
+	secret, err := emailVerificationSecret()
+	if err != nil {
+		return "", "", err
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", "", ErrVerificationTokenInvalid
+	}
+	expected := signVerification(secret, parts[0])
+	if !hmac.Equal([]byte(parts[1]), []byte(expected)) {
+		return "", "", ErrVerificationTokenInvalid
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", "", ErrVerificationTokenInvalid
+	}
+	var payload emailVerificationPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return "", "", ErrVerificationTokenInvalid
+	}
+	if time.Now().Unix() > payload.ExpiresAt {
+		return "", "", ErrVerificationTokenInvalid
+	}
+	return payload.Username, payload.Email, nil
+}
+
+func signVerification(secret []byte, encodedPayload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("email-verification:" + encodedPayload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
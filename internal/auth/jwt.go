@@ -2,32 +2,42 @@ package auth
 
 import (
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var secretKeyBytes = []byte(os.Getenv("JWT_SECRET_KEY"))
-
 // CustomClaims defines the structure of our JWT claims
 type CustomClaims struct {
 	Username string `json:"username"`
+	Role     string `json:"role"`
+	// SessionID links the access token to the refresh token family of the login that issued it
+	SessionID string `json:"sid,omitempty"`
+	// Language is the user's preferred language for API messages; empty means none
+	Language string `json:"lang,omitempty"`
+	// APIKeyID and Scopes are set when the caller authenticated with an API key; they never appear in a JWT
+	APIKeyID uint         `json:"-"`
+	Scopes   []Permission `json:"-"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken creates a new JWT token with custom claims.
-func GenerateToken(username string) (string, error) {
-	if len(secretKeyBytes) == 0 {
-		return "", fmt.Errorf("JWT_SECRET_KEY is not set in environment variables")
-	}
+// GenerateToken creates a new JWT token with custom claims, signed with the keyring's active key.
+// language is the user's preferred language, or empty.
+func GenerateToken(username string, role string, sessionID string, language string) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenTTL()) // Short-lived; renewed with a refresh token
 
-	expirationTime := time.Now().Add(24 * time.Hour) // Token expires in 24 hours
-	// expirationTime := time.Now().Add(5 * time.Minute) // For testing shorter expiration
+	jti, err := NewTokenID()
+	if err != nil {
+		return "", err
+	}
 
 	claims := &CustomClaims{
-		Username: username,
+		Username:  username,
+		Role:      NormalizeRole(role),
+		SessionID: sessionID,
+		Language:  language,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
@@ -35,8 +45,7 @@ func GenerateToken(username string) (string, error) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(secretKeyBytes)
+	tokenString, err := keyring.sign(claims)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -44,16 +53,17 @@ func GenerateToken(username string) (string, error) {
 }
 
 // VerifyToken validates the token string and returns the parsed token with CustomClaims.
+// The key is chosen by the token's kid header; tokens without one use the JWT_SECRET_KEY key.
 func VerifyToken(tokenString string) (*jwt.Token, *CustomClaims, error) {
-	if len(secretKeyBytes) == 0 {
-		return nil, nil, fmt.Errorf("JWT_SECRET_KEY is not set in environment variables")
-	}
 	claims := &CustomClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return secretKeyBytes, nil
-	})
-	return token, claims, err
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyring.keyFunc,
+		jwt.WithValidMethods([]string{AlgHS256, AlgRS256, AlgEdDSA}))
+	if err != nil {
+		return token, claims, err
+	}
+	// Reject tokens that were logged out or revoked before they expired
+	if err := CheckRevoked(claims); err != nil {
+		return token, claims, err
+	}
+	return token, claims, nil
 }
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// GenerateKeyEntry creates new key material for alg. rsaBits is only used for RS256.
+func GenerateKeyEntry(kid, alg, status string, rsaBits int) (KeyEntry, error) {
+	entry := KeyEntry{ID: kid, Alg: alg, Status: status}
+	switch alg {
+	case AlgHS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return KeyEntry{}, err
+		}
+		entry.Secret = base64.URLEncoding.EncodeToString(secret)
+	case AlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaBits)
+		if err != nil {
+			return KeyEntry{}, err
+		}
+		if entry.PrivateKey, err = encodePrivateKey(key); err != nil {
+			return KeyEntry{}, err
+		}
+	case AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return KeyEntry{}, err
+		}
+		if entry.PrivateKey, err = encodePrivateKey(key); err != nil {
+			return KeyEntry{}, err
+		}
+	default:
+		return KeyEntry{}, fmt.Errorf("unsupported algorithm %q (use %s, %s or %s)", alg, AlgHS256, AlgRS256, AlgEdDSA)
+	}
+	return entry, nil
+}
+
+func encodePrivateKey(key interface{}) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// Validate checks that every entry parses and that exactly one key is active.
+func (f *KeyringFile) Validate() error {
+	seen := make(map[string]bool, len(f.Keys))
+	active := 0
+	for _, entry := range f.Keys {
+		if seen[entry.ID] {
+			return fmt.Errorf("duplicate key id %q in keyring", entry.ID)
+		}
+		seen[entry.ID] = true
+		if _, err := parseKeyEntry(entry); err != nil {
+			return err
+		}
+		if entry.Status == KeyStatusActive {
+			active++
+		}
+	}
+	if active != 1 {
+		return fmt.Errorf("keyring must have exactly one active key, found %d", active)
+	}
+	return nil
+}
+
+// Find returns the index of the key with kid, or -1.
+func (f *KeyringFile) Find(kid string) int {
+	for i, entry := range f.Keys {
+		if entry.ID == kid {
+			return i
+		}
+	}
+	return -1
+}
+
+// JWKS returns the public keys of the file's active and verify asymmetric keys.
+func (f *KeyringFile) JWKS() (JWKSet, error) {
+	set := JWKSet{Keys: []JWK{}}
+	for _, entry := range f.Keys {
+		if entry.Status == KeyStatusRetired {
+			continue
+		}
+		key, err := parseKeyEntry(entry)
+		if err != nil {
+			return JWKSet{}, err
+		}
+		if jwk, ok := key.jwk(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set, nil
+}
+
+// WriteKeyringFile validates file and writes it to path with 0600 permissions.
+// The file is written to a temporary file first and renamed, so a crash never leaves a half-written keyring.
+func WriteKeyringFile(path string, file *KeyringFile) error {
+	if err := file.Validate(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keyring-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary keyring file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
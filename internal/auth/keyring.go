@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key statuses. Exactly one key is active (signs new tokens); verify keys
+// still validate tokens they signed earlier; retired keys are ignored.
+const (
+	KeyStatusActive  = "active"
+	KeyStatusVerify  = "verify"
+	KeyStatusRetired = "retired"
+)
+
+// legacyKeyID identifies the key built from JWT_SECRET_KEY. It signs when no keyring file is
+// configured; with a keyring file it only verifies, so tokens issued before the switch keep
+// working. Tokens without a kid header are verified with it.
+const legacyKeyID = "default"
+
+// KeyEntry is one key as stored in the keyring file.
+type KeyEntry struct {
+	ID     string `json:"kid"`
+	Alg    string `json:"alg"`
+	Status string `json:"status"`
+	// Secret is the HMAC secret (HS256), used as-is like JWT_SECRET_KEY
+	Secret string `json:"secret,omitempty"`
+	// PrivateKey is a PEM encoded PKCS#8 (or PKCS#1 RSA) private key (RS256, EdDSA)
+	PrivateKey string `json:"private_key,omitempty"`
+}
+
+// KeyringFile is the JSON document read from JWT_KEYRING_FILE.
+type KeyringFile struct {
+	Keys []KeyEntry `json:"keys"`
+}
+
+// signingKey is a parsed, usable key.
+type signingKey struct {
+	id     string
+	alg    string
+	status string
+	method jwt.SigningMethod
+	sign   interface{} // []byte for HMAC, crypto.Signer otherwise
+	verify interface{} // []byte for HMAC, public key otherwise
+}
+
+// Keyring holds the keys used to sign and verify tokens.
+type Keyring struct {
+	mu     sync.RWMutex
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+var keyring = &Keyring{keys: map[string]*signingKey{}}
+
+// InitKeyring loads the keys from JWT_KEYRING_FILE, or falls back to a single
+// HS256 key from JWT_SECRET_KEY. Call it after the environment is loaded, and
+// again (e.g. on SIGHUP) to pick up a rotated keyring.
+func InitKeyring() error {
+	var keys map[string]*signingKey
+	var err error
+	if path := os.Getenv("JWT_KEYRING_FILE"); path != "" {
+		keys, err = loadKeyringFile(path)
+		if err == nil {
+			err = addLegacyVerifyKey(keys)
+		}
+	} else {
+		keys, err = legacyKeys()
+	}
+	if err != nil {
+		return err
+	}
+
+	var active *signingKey
+	for _, key := range keys {
+		if key.status == KeyStatusActive {
+			if active != nil {
+				return fmt.Errorf("keyring has more than one active key (%s, %s)", active.id, key.id)
+			}
+			active = key
+		}
+	}
+	if active == nil {
+		return errors.New("keyring has no active key")
+	}
+
+	keyring.mu.Lock()
+	keyring.active = active
+	keyring.keys = keys
+	keyring.mu.Unlock()
+	return nil
+}
+
+func legacyKeys() (map[string]*signingKey, error) {
+	secret := os.Getenv("JWT_SECRET_KEY")
+	if secret == "" {
+		return nil, fmt.Errorf("JWT_SECRET_KEY is not set in environment variables and no JWT_KEYRING_FILE is configured")
+	}
+	key, err := parseKeyEntry(KeyEntry{ID: legacyKeyID, Alg: AlgHS256, Status: KeyStatusActive, Secret: secret})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]*signingKey{legacyKeyID: key}, nil
+}
+
+// addLegacyVerifyKey adds JWT_SECRET_KEY, if still set, to a keyring file's keys as a verify
+// key, so tokens signed before the keyring file was introduced stay valid until they expire.
+// A key in the file with the legacy kid takes precedence.
+func addLegacyVerifyKey(keys map[string]*signingKey) error {
+	secret := os.Getenv("JWT_SECRET_KEY")
+	if _, exists := keys[legacyKeyID]; exists || secret == "" {
+		return nil
+	}
+	key, err := parseKeyEntry(KeyEntry{ID: legacyKeyID, Alg: AlgHS256, Status: KeyStatusVerify, Secret: secret})
+	if err != nil {
+		return fmt.Errorf("JWT_SECRET_KEY: %w", err)
+	}
+	keys[legacyKeyID] = key
+	return nil
+}
+
+// ReadKeyringFile reads and decodes a keyring file without parsing the keys.
+func ReadKeyringFile(path string) (*KeyringFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring file: %w", err)
+	}
+	var file KeyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring file: %w", err)
+	}
+	return &file, nil
+}
+
+func loadKeyringFile(path string) (map[string]*signingKey, error) {
+	file, err := ReadKeyringFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*signingKey, len(file.Keys))
+	for _, entry := range file.Keys {
+		if entry.Status == KeyStatusRetired {
+			continue
+		}
+		if _, exists := keys[entry.ID]; exists {
+			return nil, fmt.Errorf("duplicate key id %q in keyring", entry.ID)
+		}
+		key, err := parseKeyEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		keys[entry.ID] = key
+	}
+	return keys, nil
+}
+
+// parseKeyEntry validates an entry and decodes its key material.
+func parseKeyEntry(entry KeyEntry) (*signingKey, error) {
+	if entry.ID == "" {
+		return nil, errors.New("key has no kid")
+	}
+	switch entry.Status {
+	case KeyStatusActive, KeyStatusVerify, KeyStatusRetired:
+	default:
+		return nil, fmt.Errorf("key %s: unknown status %q", entry.ID, entry.Status)
+	}
+
+	key := &signingKey{id: entry.ID, alg: entry.Alg, status: entry.Status}
+	switch entry.Alg {
+	case AlgHS256:
+		if len(entry.Secret) < 32 {
+			return nil, fmt.Errorf("key %s: HS256 secret must be at least 32 characters", entry.ID)
+		}
+		key.method = jwt.SigningMethodHS256
+		key.sign = []byte(entry.Secret)
+		key.verify = []byte(entry.Secret)
+	case AlgRS256, AlgEdDSA:
+		signer, err := parsePrivateKey(entry.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", entry.ID, err)
+		}
+		switch signer.(type) {
+		case *rsa.PrivateKey:
+			if entry.Alg != AlgRS256 {
+				return nil, fmt.Errorf("key %s: RSA key cannot be used with %s", entry.ID, entry.Alg)
+			}
+			key.method = jwt.SigningMethodRS256
+		case ed25519.PrivateKey:
+			if entry.Alg != AlgEdDSA {
+				return nil, fmt.Errorf("key %s: Ed25519 key cannot be used with %s", entry.ID, entry.Alg)
+			}
+			key.method = jwt.SigningMethodEdDSA
+		default:
+			return nil, fmt.Errorf("key %s: unsupported private key type %T", entry.ID, signer)
+		}
+		key.sign = signer
+		key.verify = signer.Public()
+	default:
+		return nil, fmt.Errorf("key %s: unsupported algorithm %q", entry.ID, entry.Alg)
+	}
+	return key, nil
+}
+
+func parsePrivateKey(pemData string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return nil, errors.New("private_key is not PEM encoded")
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+	return signer, nil
+}
+
+// sign signs claims with the active key and sets the kid header.
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	active := k.active
+	k.mu.RUnlock()
+	if active == nil {
+		return "", errors.New("keyring is not initialized")
+	}
+
+	token := jwt.NewWithClaims(active.method, claims)
+	token.Header["kid"] = active.id
+	return token.SignedString(active.sign)
+}
+
+// keyFunc finds the verification key named by the token's kid header and
+// checks that the token uses that key's algorithm.
+func (k *Keyring) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = legacyKeyID
+	}
+
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.verify, nil
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// mfaMaxAttempts is how many wrong codes a login challenge survives.
+const mfaMaxAttempts = 5
+
+// MFAChallenge is the state of a login that passed the password check and still needs a second factor.
+type MFAChallenge struct {
+	Username string
+	// Enroll is set when the user has no second factor yet but policy requires one;
+	// the challenge then only allows enrolling and confirming a TOTP secret.
+	Enroll    bool
+	ExpiresAt time.Time
+	attempts  int
+}
+
+// MFAChallengeStore keeps pending login challenges in memory, keyed by an opaque
+// token handed to the client in place of an access token.
+type MFAChallengeStore struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	challenges map[string]*MFAChallenge
+}
+
+// NewMFAChallengeStore creates an MFAChallengeStore whose challenges expire after ttl.
+func NewMFAChallengeStore(ttl time.Duration) *MFAChallengeStore {
+	return &MFAChallengeStore{
+		ttl:        ttl,
+		challenges: make(map[string]*MFAChallenge),
+	}
+}
+
+// Issue starts a challenge for username and returns its token and expiry time.
+func (s *MFAChallengeStore) Issue(username string, enroll bool) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	expiresAt := time.Now().Add(s.ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purgeExpiredLocked()
+	s.challenges[token] = &MFAChallenge{Username: username, Enroll: enroll, ExpiresAt: expiresAt}
+	return token, expiresAt, nil
+}
+
+// Get returns a copy of the challenge for token, or false if it is unknown or expired.
+func (s *MFAChallengeStore) Get(token string) (MFAChallenge, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	challenge, ok := s.challenges[token]
+	if !ok {
+		return MFAChallenge{}, false
+	}
+	if time.Now().After(challenge.ExpiresAt) {
+		delete(s.challenges, token)
+		return MFAChallenge{}, false
+	}
+	return *challenge, true
+}
+
+// Fail records a wrong code and discards the challenge once it has used up its attempts.
+func (s *MFAChallengeStore) Fail(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if challenge, ok := s.challenges[token]; ok {
+		challenge.attempts++
+		if challenge.attempts >= mfaMaxAttempts {
+			delete(s.challenges, token)
+		}
+	}
+}
+
+// Complete consumes the challenge. It returns false if it was already used or discarded,
+// so two concurrent requests cannot both finish the same login.
+func (s *MFAChallengeStore) Complete(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.challenges[token]; !ok {
+		return false
+	}
+	delete(s.challenges, token)
+	return true
+}
+
+func (s *MFAChallengeStore) purgeExpiredLocked() {
+	now := time.Now()
+	for token, challenge := range s.challenges {
+		if now.After(challenge.ExpiresAt) {
+			delete(s.challenges, token)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"order-notification-system/internal/config"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// defaultPasswordHashCost is the bcrypt cost used when BCRYPT_COST is unset.
+const defaultPasswordHashCost = 12
+
+// maxPasswordBytes is the longest password bcrypt actually uses; anything after it is ignored.
+const maxPasswordBytes = 72
+
+// PasswordHashCost is the bcrypt cost for new hashes (BCRYPT_COST, default 12).
+// Existing hashes with a different cost are rehashed at the next successful login.
+func PasswordHashCost() int {
+	cost := config.GetEnvInt("BCRYPT_COST", defaultPasswordHashCost)
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		log.Printf("⚠️ BCRYPT_COST=%d is outside %d-%d, using default %d", cost, bcrypt.MinCost, bcrypt.MaxCost, defaultPasswordHashCost)
+		return defaultPasswordHashCost
+	}
+	return cost
+}
+
+// HashPassword returns the bcrypt hash of password at the configured cost.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), PasswordHashCost())
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// PasswordNeedsRehash reports whether hash was made with a cost other than the configured one.
+func PasswordNeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost != PasswordHashCost()
+}
+
+// PasswordPolicy holds the rules new passwords must satisfy.
+type PasswordPolicy struct {
+	// MinLength is counted in characters; the maximum is always bcrypt's 72 bytes.
+	MinLength int
+	// BreachedListFile lists passwords known from breaches, one per line, either in plain
+	// text or as SHA-1 hex digests (optionally followed by ":count", as in HIBP downloads).
+	BreachedListFile string
+}
+
+// LoadPasswordPolicy reads the password policy from environment variables.
+func LoadPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:        config.GetEnvInt("PASSWORD_MIN_LENGTH", 8),
+		BreachedListFile: config.GetEnv("PASSWORD_BREACHED_LIST_FILE", ""),
+	}
+}
+
+// breachedListMaxInMemory is the largest breached list that is read into memory. Larger lists,
+// such as the Have I Been Pwned download, must be SHA-1 digests sorted by hash; they are
+// binary searched on disk.
+const breachedListMaxInMemory = 64 << 20
+
+var (
+	breachedMu   sync.Mutex
+	breachedFile string
+	breached     breachedList
+)
+
+// breachedList answers whether an upper-case SHA-1 hex digest is listed.
+type breachedList interface {
+	contains(digest string) (bool, error)
+}
+
+// PasswordPolicyError is a policy violation. Message is shown to the user (translated),
+// formatted with Args.
+type PasswordPolicyError struct {
+	Message string
+	Args    []interface{}
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return fmt.Sprintf(e.Message, e.Args...)
+}
+
+// Validate checks password for the account identified by username and email.
+// A violation is returned as a *PasswordPolicyError.
+func (p PasswordPolicy) Validate(password, username, email string) error {
+	if len([]rune(password)) < p.MinLength {
+		return &PasswordPolicyError{Message: "must be at least %d characters", Args: []interface{}{p.MinLength}}
+	}
+	if len(password) > maxPasswordBytes {
+		return &PasswordPolicyError{Message: "must be at most %d bytes", Args: []interface{}{maxPasswordBytes}}
+	}
+	if similarToIdentity(password, username, email) {
+		return &PasswordPolicyError{Message: "must not contain or resemble your username or email address"}
+	}
+	if p.BreachedListFile != "" {
+		breached, err := isBreachedPassword(p.BreachedListFile, password)
+		if err != nil {
+			// A missing list must not block every registration; log it loudly instead
+			log.Printf("⚠️ Could not check breached password list %s: %v", p.BreachedListFile, err)
+		} else if breached {
+			return &PasswordPolicyError{Message: "has appeared in a data breach; please choose another one"}
+		}
+	}
+	return nil
+}
+
+// similarToIdentity reports whether password contains the username or the email's local part,
+// or is contained in either, ignoring case, spacing and punctuation.
+func similarToIdentity(password, username, email string) bool {
+	normalizedPassword := normalizeForComparison(password)
+	identities := []string{username}
+	if at := strings.Index(email, "@"); at > 0 {
+		identities = append(identities, email[:at])
+	}
+	for _, identity := range identities {
+		normalized := normalizeForComparison(identity)
+		if len(normalized) < 3 {
+			continue
+		}
+		if strings.Contains(normalizedPassword, normalized) ||
+			(len(normalizedPassword) >= 3 && strings.Contains(normalized, normalizedPassword)) {
+			return true
+		}
+		if strings.Contains(normalizedPassword, reverse(normalized)) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeForComparison(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(value) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r > 127 {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func reverse(value string) string {
+	runes := []rune(value)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// InitBreachedList opens the breached password list of the policy, if any, so a list that
+// cannot be used stops the server at startup instead of being skipped at the first registration.
+func InitBreachedList() error {
+	path := LoadPasswordPolicy().BreachedListFile
+	if path == "" {
+		return nil
+	}
+	_, err := breachedListFor(path)
+	return err
+}
+
+// isBreachedPassword looks password up in the breached list at path, opening the list on first use.
+func isBreachedPassword(path, password string) (bool, error) {
+	list, err := breachedListFor(path)
+	if err != nil {
+		return false, err
+	}
+	return list.contains(sha1Hex(password))
+}
+
+func breachedListFor(path string) (breachedList, error) {
+	breachedMu.Lock()
+	defer breachedMu.Unlock()
+
+	if breached == nil || breachedFile != path {
+		list, err := openBreachedList(path)
+		if err != nil {
+			return nil, err
+		}
+		if closer, ok := breached.(io.Closer); ok {
+			closer.Close()
+		}
+		breached, breachedFile = list, path
+	}
+	return breached, nil
+}
+
+// openBreachedList reads a small list into memory and opens a large one for searching on disk.
+func openBreachedList(path string) (breachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size() <= breachedListMaxInMemory {
+		defer file.Close()
+		return loadBreachedList(file, path)
+	}
+
+	list := &sortedDigestFile{file: file, size: info.Size()}
+	if err := list.checkSorted(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s is larger than %d MB, so it must list SHA-1 digests sorted by hash, like the Have I Been Pwned download: %w",
+			path, breachedListMaxInMemory>>20, err)
+	}
+	log.Printf("Searching breached passwords in %s (%d MB) on disk", path, info.Size()>>20)
+	return list, nil
+}
+
+// digestSet is a breached list held in memory.
+type digestSet map[string]bool
+
+func (s digestSet) contains(digest string) (bool, error) {
+	return s[digest], nil
+}
+
+func loadBreachedList(file io.Reader, path string) (digestSet, error) {
+	hashes := make(digestSet)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if digest := strings.SplitN(line, ":", 2)[0]; isSHA1Hex(digest) {
+			hashes[strings.ToUpper(digest)] = true
+		} else {
+			hashes[sha1Hex(line)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d breached passwords from %s", len(hashes), path)
+	return hashes, nil
+}
+
+// sortedDigestFile is a breached list of "DIGEST[:count]" lines sorted by digest, binary searched on disk.
+type sortedDigestFile struct {
+	file *os.File
+	size int64
+}
+
+func (f *sortedDigestFile) Close() error {
+	return f.file.Close()
+}
+
+func (f *sortedDigestFile) contains(digest string) (bool, error) {
+	// Every line that could match starts in [lo, hi); lo is always the start of a line
+	lo, hi := int64(0), f.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, next, line, err := f.lineAt(mid)
+		if err != nil {
+			return false, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+		lineDigest, err := digestOf(line)
+		if err != nil {
+			return false, fmt.Errorf("line at byte %d: %w", start, err)
+		}
+		switch {
+		case lineDigest == digest:
+			return true, nil
+		case lineDigest < digest:
+			lo = next
+		default:
+			hi = mid
+		}
+	}
+	return false, nil
+}
+
+// lineAt returns the first line starting at or after offset, its start and the start of the line after it.
+// At the end of the file start is the file size.
+func (f *sortedDigestFile) lineAt(offset int64) (start, next int64, line string, err error) {
+	start = offset
+	if offset > 0 {
+		// Read from the byte before offset, so a line starting exactly at offset is kept
+		start = offset - 1
+	}
+	reader := bufio.NewReaderSize(io.NewSectionReader(f.file, start, f.size-start), 256)
+	if offset > 0 {
+		skipped, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return f.size, f.size, "", nil
+		}
+		if err != nil {
+			return 0, 0, "", err
+		}
+		start += int64(len(skipped))
+	}
+	raw, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, 0, "", err
+	}
+	return start, start + int64(len(raw)), strings.TrimSpace(raw), nil
+}
+
+// checkSorted samples lines across the file and checks that they are digests in ascending order.
+func (f *sortedDigestFile) checkSorted() error {
+	const samples = 64
+	previous := ""
+	for i := int64(0); i <= samples; i++ {
+		start, _, line, err := f.lineAt(f.size * i / samples)
+		if err != nil {
+			return err
+		}
+		if start >= f.size {
+			break
+		}
+		digest, err := digestOf(line)
+		if err != nil {
+			return fmt.Errorf("line at byte %d: %w", start, err)
+		}
+		if digest < previous {
+			return fmt.Errorf("line at byte %d is out of order", start)
+		}
+		previous = digest
+	}
+	return nil
+}
+
+// digestOf returns the upper-case digest of a "DIGEST[:count]" line.
+func digestOf(line string) (string, error) {
+	digest := strings.SplitN(line, ":", 2)[0]
+	if !isSHA1Hex(digest) {
+		return "", errors.New("not a SHA-1 digest")
+	}
+	return strings.ToUpper(digest), nil
+}
+
+func sha1Hex(value string) string {
+	sum := sha1.Sum([]byte(value))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1Hex(value string) bool {
+	if len(value) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
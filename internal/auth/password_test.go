@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// openSortedDigestFile writes content to a temporary file and opens it as a sortedDigestFile.
+func openSortedDigestFile(t *testing.T, content string) *sortedDigestFile {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &sortedDigestFile{file: file, size: info.Size()}
+}
+
+func TestSortedDigestFileContains(t *testing.T) {
+	var listed []string
+	for _, password := range []string{"password", "123456", "qwerty", "letmein", "dragon", "monkey", "football"} {
+		listed = append(listed, sha1Hex(password))
+	}
+	sort.Strings(listed)
+
+	lines := make([]string, len(listed))
+	for i, digest := range listed {
+		lines[i] = digest + ":" + strings.Repeat("7", i+1)
+	}
+	files := map[string]string{
+		"with counts":         strings.Join(lines, "\n") + "\n",
+		"no trailing newline": strings.Join(lines, "\n"),
+		"CRLF":                strings.Join(lines, "\r\n") + "\r\n",
+		"digests only":        strings.Join(listed, "\n") + "\n",
+	}
+
+	tests := []struct {
+		name   string
+		digest string
+		want   bool
+	}{
+		{"first line", listed[0], true},
+		{"middle line", listed[len(listed)/2], true},
+		{"last line", listed[len(listed)-1], true},
+		{"before first", strings.Repeat("0", 40), false},
+		{"after last", strings.Repeat("F", 40), false},
+		{"not listed", sha1Hex("correct horse battery staple"), false},
+	}
+	for fileName, content := range files {
+		list := openSortedDigestFile(t, content)
+		if err := list.checkSorted(); err != nil {
+			t.Fatalf("%s: checkSorted: %v", fileName, err)
+		}
+		for _, tt := range tests {
+			t.Run(fileName+"/"+tt.name, func(t *testing.T) {
+				got, err := list.contains(tt.digest)
+				if err != nil {
+					t.Fatalf("contains: %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("contains(%s) = %v, want %v", tt.digest, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestSortedDigestFileCheckSorted(t *testing.T) {
+	low, high := strings.Repeat("0", 40), strings.Repeat("F", 40)
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"sorted", low + ":1\n" + high + ":1\n", false},
+		{"out of order", high + ":1\n" + low + ":1\n", true},
+		{"plaintext passwords", "password\n123456\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := openSortedDigestFile(t, tt.content).checkSorted()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkSorted() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
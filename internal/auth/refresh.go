@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"order-notification-system/internal/config"
+)
+
+// AccessTokenTTL is the lifetime of access tokens (JWT_EXPIRATION, default 15m).
+func AccessTokenTTL() time.Duration {
+	return config.GetEnvDuration("JWT_EXPIRATION", 15*time.Minute)
+}
+
+// RefreshTokenTTL is the lifetime of refresh tokens (JWT_REFRESH_EXPIRATION, default 720h).
+func RefreshTokenTTL() time.Duration {
+	return config.GetEnvDuration("JWT_REFRESH_EXPIRATION", 30*24*time.Hour)
+}
+
+// NewOpaqueToken returns a random opaque token (refresh token, reset link, ...) and the hash to store for it.
+// Only the hash is persisted; the raw token is handed to the client once.
+func NewOpaqueToken() (string, string, error) {
+	raw, err := randomString(32)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return raw, HashOpaqueToken(raw), nil
+}
+
+// HashOpaqueToken returns the hex SHA-256 of a raw opaque token.
+// These tokens are high-entropy, so a fast unsalted hash is sufficient.
+func HashOpaqueToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewTokenID returns a random identifier, used for refresh token families and access token jti values.
+func NewTokenID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token family: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func randomString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
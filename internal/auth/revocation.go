@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"order-notification-system/internal/config"
+	"order-notification-system/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrTokenRevoked is returned by VerifyToken for a token that was logged out or revoked.
+	ErrTokenRevoked = errors.New("token has been revoked")
+	// ErrAccountSuspended is returned by VerifyToken for a token of a suspended user.
+	ErrAccountSuspended = errors.New("account is suspended")
+)
+
+// RevocationStore keeps revoked token IDs, revoked sessions and suspended accounts in the database,
+// with an in-memory copy so checking a token never hits the database.
+// The copy is reloaded every REVOCATION_SYNC_INTERVAL (default 30s) to pick up
+// revocations made by other instances.
+type RevocationStore struct {
+	db       *gorm.DB
+	mu       sync.RWMutex
+	revoked  map[string]time.Time // jti -> token expiry
+	sessions map[string]time.Time // sid -> when the last access token of the session expires
+	// suspended holds suspended usernames, whose tokens are rejected whenever they were issued
+	suspended map[string]bool
+}
+
+// revocations is the store consulted by VerifyToken; nil until InitRevocationStore is called.
+var revocations *RevocationStore
+
+// InitRevocationStore loads the revocation data and starts the background sync.
+func InitRevocationStore(db *gorm.DB) (*RevocationStore, error) {
+	store := &RevocationStore{db: db}
+	if err := store.reload(); err != nil {
+		return nil, err
+	}
+	revocations = store
+
+	interval := config.GetEnvDuration("REVOCATION_SYNC_INTERVAL", 30*time.Second)
+	go func() {
+		for range time.Tick(interval) {
+			if err := models.PurgeExpiredRevokedTokens(db); err != nil {
+				log.Printf("Error purging expired revoked tokens: %v", err)
+			}
+			if err := store.reload(); err != nil {
+				log.Printf("Error reloading token revocations: %v", err)
+			}
+		}
+	}()
+	return store, nil
+}
+
+// Revocations returns the store initialized by InitRevocationStore.
+func Revocations() *RevocationStore {
+	return revocations
+}
+
+func (s *RevocationStore) reload() error {
+	tokens, err := models.GetActiveRevokedTokens(s.db)
+	if err != nil {
+		return err
+	}
+	sessions, err := models.GetActiveRevokedSessions(s.db)
+	if err != nil {
+		return err
+	}
+
+	suspendedUsers, err := models.GetSuspendedUsernames(s.db)
+	if err != nil {
+		return err
+	}
+
+	revoked := make(map[string]time.Time, len(tokens))
+	for _, token := range tokens {
+		revoked[token.JTI] = token.ExpiresAt
+	}
+	sessionMap := make(map[string]time.Time, len(sessions))
+	for _, session := range sessions {
+		sessionMap[session.SessionID] = session.ExpiresAt
+	}
+
+	suspended := make(map[string]bool, len(suspendedUsers))
+	for _, username := range suspendedUsers {
+		suspended[username] = true
+	}
+
+	s.mu.Lock()
+	s.revoked = revoked
+	s.sessions = sessionMap
+	s.suspended = suspended
+	s.mu.Unlock()
+	return nil
+}
+
+// RevokeToken revokes a single access token until it expires.
+func (s *RevocationStore) RevokeToken(claims *CustomClaims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return errors.New("token has no jti or expiry")
+	}
+	err := models.RevokeToken(s.db, &models.RevokedToken{
+		JTI:       claims.ID,
+		Username:  claims.Username,
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.revoked[claims.ID] = claims.ExpiresAt.Time
+	s.mu.Unlock()
+	return nil
+}
+
+// RevokeUser ends every session of username: their refresh tokens are revoked, then every session
+// that may still have a live access token. Tokens are matched by session rather than by issue
+// time, so a login made right after the call is not affected.
+func (s *RevocationStore) RevokeUser(username string) error {
+	// Refresh tokens first, so no session can issue an access token after it was listed
+	if err := models.RevokeUserRefreshTokens(s.db, username); err != nil {
+		return err
+	}
+	sessionIDs, err := models.GetRecentSessionIDs(s.db, username, time.Now().Add(-AccessTokenTTL()))
+	if err != nil {
+		return err
+	}
+	return s.revokeSessions(sessionIDs)
+}
+
+// RevokeSession rejects the access tokens of one login, e.g. when its refresh token was reused.
+// The session's refresh tokens must already be revoked.
+func (s *RevocationStore) RevokeSession(sessionID string) error {
+	return s.revokeSessions([]string{sessionID})
+}
+
+// revokeSessions revokes every access token of the given sessions. Their refresh tokens must
+// already be revoked, so a session's tokens only need rejecting for one access token lifetime.
+func (s *RevocationStore) revokeSessions(sessionIDs []string) error {
+	expiresAt := time.Now().Add(AccessTokenTTL())
+	if err := models.RevokeSessions(s.db, sessionIDs, expiresAt); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for _, id := range sessionIDs {
+		s.sessions[id] = expiresAt
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// SetSuspended records in the cache that username was suspended or reactivated.
+// The users table is the source of truth; other instances pick the change up at their next reload.
+func (s *RevocationStore) SetSuspended(username string, suspended bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if suspended {
+		s.suspended[username] = true
+	} else {
+		delete(s.suspended, username)
+	}
+}
+
+// IsSuspended reports whether username belongs to a suspended account.
+func (s *RevocationStore) IsSuspended(username string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.suspended[username]
+}
+
+// IsRevoked reports whether claims belong to a revoked token.
+func (s *RevocationStore) IsRevoked(claims *CustomClaims) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.revoked[claims.ID]; ok && claims.ID != "" {
+		return true
+	}
+	if _, ok := s.sessions[claims.SessionID]; ok && claims.SessionID != "" {
+		return true
+	}
+	return false
+}
+
+// CheckRevoked returns ErrAccountSuspended or ErrTokenRevoked when the default store knows claims to be unusable.
+func CheckRevoked(claims *CustomClaims) error {
+	if revocations == nil {
+		return nil
+	}
+	if revocations.IsSuspended(claims.Username) {
+		return ErrAccountSuspended
+	}
+	if revocations.IsRevoked(claims) {
+		return ErrTokenRevoked
+	}
+	return nil
+}
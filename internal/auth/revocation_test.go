@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testRevocationStore returns a store with one revoked token, one revoked session and one
+// suspended user, as reload would leave it. It has no database, so only the checks work.
+func testRevocationStore() *RevocationStore {
+	expiresAt := time.Now().Add(time.Hour)
+	return &RevocationStore{
+		revoked:   map[string]time.Time{"revoked-jti": expiresAt},
+		sessions:  map[string]time.Time{"revoked-sid": expiresAt},
+		suspended: map[string]bool{"suspended": true},
+	}
+}
+
+func testClaims(username, sessionID, jti string) *CustomClaims {
+	return &CustomClaims{
+		Username:         username,
+		SessionID:        sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{ID: jti},
+	}
+}
+
+func TestRevocationStoreIsRevoked(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims *CustomClaims
+		want   bool
+	}{
+		{"valid token", testClaims("somchai", "live-sid", "live-jti"), false},
+		{"revoked token", testClaims("somchai", "live-sid", "revoked-jti"), true},
+		{"token of revoked session", testClaims("somchai", "revoked-sid", "other-jti"), true},
+		// A login made after "log out everywhere" starts a new session
+		{"new session of same user", testClaims("somchai", "new-sid", "new-jti"), false},
+		{"no jti or session", testClaims("somchai", "", ""), false},
+	}
+	store := testRevocationStore()
+	// Empty IDs must never match, even if one was stored by mistake
+	store.revoked[""] = time.Now().Add(time.Hour)
+	store.sessions[""] = time.Now().Add(time.Hour)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := store.IsRevoked(tt.claims); got != tt.want {
+				t.Errorf("IsRevoked = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRevoked(t *testing.T) {
+	previous := revocations
+	revocations = testRevocationStore()
+	t.Cleanup(func() { revocations = previous })
+
+	tests := []struct {
+		name   string
+		claims *CustomClaims
+		want   error
+	}{
+		{"valid token", testClaims("somchai", "live-sid", "live-jti"), nil},
+		{"revoked session", testClaims("somchai", "revoked-sid", "live-jti"), ErrTokenRevoked},
+		{"suspended user", testClaims("suspended", "live-sid", "live-jti"), ErrAccountSuspended},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckRevoked(tt.claims); !errors.Is(err, tt.want) {
+				t.Errorf("CheckRevoked = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	revocations.SetSuspended("suspended", false)
+	if err := CheckRevoked(testClaims("suspended", "live-sid", "live-jti")); err != nil {
+		t.Errorf("CheckRevoked after reactivation = %v, want nil", err)
+	}
+}
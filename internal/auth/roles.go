@@ -0,0 +1,87 @@
+package auth
+
+// Roles stored on models.User and embedded in the JWT.
+const (
+	RoleAdmin    = "admin"
+	RoleManager  = "manager"
+	RoleKitchen  = "kitchen"
+	RoleCashier  = "cashier"
+	RoleCustomer = "customer"
+)
+
+// Permission names an action guarded by RequirePermission.
+type Permission string
+
+// Permissions granted to roles.
+const (
+	PermManageUsers          Permission = "users:manage"
+	PermManageProducts       Permission = "products:manage"
+	PermViewOrders           Permission = "orders:view"
+	PermUpdateOrders         Permission = "orders:update"
+	PermPublishAnnouncements Permission = "announcements:publish"
+	PermViewSystemStats      Permission = "system:stats"
+	PermManageAPIKeys        Permission = "apikeys:manage"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PermManageUsers, PermManageProducts, PermViewOrders, PermUpdateOrders,
+		PermPublishAnnouncements, PermViewSystemStats, PermManageAPIKeys,
+	},
+	RoleManager: {
+		PermManageProducts, PermViewOrders, PermUpdateOrders, PermPublishAnnouncements,
+	},
+	RoleKitchen: {
+		PermViewOrders, PermUpdateOrders,
+	},
+	RoleCashier: {
+		PermViewOrders, PermUpdateOrders,
+	},
+	RoleCustomer: {},
+}
+
+// IsValidRole reports whether role is one of the known roles.
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// NormalizeRole maps an empty or unknown role to RoleCustomer, the least privileged role.
+func NormalizeRole(role string) string {
+	if IsValidRole(role) {
+		return role
+	}
+	return RoleCustomer
+}
+
+// HasPermission reports whether role grants permission.
+func HasPermission(role string, permission Permission) bool {
+	for _, granted := range rolePermissions[NormalizeRole(role)] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAPIKey reports whether the caller authenticated with an API key rather than as a user.
+func (c *CustomClaims) IsAPIKey() bool {
+	return c.APIKeyID != 0
+}
+
+// Can reports whether the caller may perform permission. The role must grant it and,
+// for an API key with scopes, the scopes must include it too.
+func (c *CustomClaims) Can(permission Permission) bool {
+	if !HasPermission(c.Role, permission) {
+		return false
+	}
+	if len(c.Scopes) == 0 {
+		return true
+	}
+	for _, scope := range c.Scopes {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
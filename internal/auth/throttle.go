@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"order-notification-system/internal/config"
+)
+
+// ThrottleConfig controls login failure handling.
+type ThrottleConfig struct {
+	// FreeAttempts failures are allowed before delays start.
+	FreeAttempts int
+	// BaseDelay is the wait after the first delayed failure; it doubles with each further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// AccountMaxFailures failures for one username lock that account for LockoutDuration.
+	AccountMaxFailures int
+	// IPMaxFailures failures from one IP block that IP for LockoutDuration.
+	IPMaxFailures   int
+	LockoutDuration time.Duration
+	// Window is how long a counter survives without new failures.
+	Window time.Duration
+	// MaxEntries caps the counters kept per username and per IP, so failures with
+	// ever new usernames or addresses cannot grow memory without bound.
+	MaxEntries int
+}
+
+// LoadThrottleConfig reads the login throttle settings from environment variables.
+func LoadThrottleConfig() ThrottleConfig {
+	return ThrottleConfig{
+		FreeAttempts:       config.GetEnvInt("LOGIN_FREE_ATTEMPTS", 3),
+		BaseDelay:          config.GetEnvDuration("LOGIN_BASE_DELAY", time.Second),
+		MaxDelay:           config.GetEnvDuration("LOGIN_MAX_DELAY", 30*time.Second),
+		AccountMaxFailures: config.GetEnvInt("LOGIN_ACCOUNT_MAX_FAILURES", 10),
+		IPMaxFailures:      config.GetEnvInt("LOGIN_IP_MAX_FAILURES", 50),
+		LockoutDuration:    config.GetEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		Window:             config.GetEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		MaxEntries:         config.GetEnvInt("LOGIN_THROTTLE_MAX_ENTRIES", 100000),
+	}
+}
+
+// LoadResetThrottleConfig reads the limits on password reset requests from environment variables.
+// Every request counts as a failure of the client IP, which is blocked after IPMaxFailures.
+// Every reset email sent counts as a failure of the requested account, whose delays only
+// hold back further emails and never reject a request.
+func LoadResetThrottleConfig() ThrottleConfig {
+	return ThrottleConfig{
+		FreeAttempts:    config.GetEnvInt("PASSWORD_RESET_FREE_REQUESTS", 3),
+		BaseDelay:       config.GetEnvDuration("PASSWORD_RESET_BASE_DELAY", time.Minute),
+		MaxDelay:        config.GetEnvDuration("PASSWORD_RESET_MAX_DELAY", time.Hour),
+		IPMaxFailures:   config.GetEnvInt("PASSWORD_RESET_IP_MAX_REQUESTS", 20),
+		LockoutDuration: config.GetEnvDuration("PASSWORD_RESET_IP_BLOCK_DURATION", time.Hour),
+		Window:          config.GetEnvDuration("PASSWORD_RESET_WINDOW", time.Hour),
+		MaxEntries:      config.GetEnvInt("LOGIN_THROTTLE_MAX_ENTRIES", 100000),
+	}
+}
+
+// LoadVerificationThrottleConfig reads the limits on resending verification emails from environment
+// variables. Every email sent counts as a failure of the account: the next one is held back for
+// EMAIL_VERIFICATION_RESEND_BASE_DELAY, doubling with each further email.
+func LoadVerificationThrottleConfig() ThrottleConfig {
+	return ThrottleConfig{
+		BaseDelay:  config.GetEnvDuration("EMAIL_VERIFICATION_RESEND_BASE_DELAY", time.Minute),
+		MaxDelay:   config.GetEnvDuration("EMAIL_VERIFICATION_RESEND_MAX_DELAY", time.Hour),
+		Window:     config.GetEnvDuration("EMAIL_VERIFICATION_RESEND_WINDOW", time.Hour),
+		MaxEntries: config.GetEnvInt("LOGIN_THROTTLE_MAX_ENTRIES", 100000),
+	}
+}
+
+type failureCounter struct {
+	failures    int
+	lastFailure time.Time
+	blockedTill time.Time
+}
+
+// LoginThrottle counts failed logins per username and per IP in memory and
+// imposes progressively longer waits between attempts. Usernames are counted
+// whether or not the account exists, so throttling reveals nothing.
+type LoginThrottle struct {
+	cfg      ThrottleConfig
+	mu       sync.Mutex
+	accounts map[string]*failureCounter
+	ips      map[string]*failureCounter
+	// lastSweep is when expired counters were last removed
+	lastSweep time.Time
+}
+
+// NewLoginThrottle creates a LoginThrottle.
+func NewLoginThrottle(cfg ThrottleConfig) *LoginThrottle {
+	return &LoginThrottle{
+		cfg:       cfg,
+		accounts:  make(map[string]*failureCounter),
+		ips:       make(map[string]*failureCounter),
+		lastSweep: time.Now(),
+	}
+}
+
+// LockoutDuration is how long an account or IP stays locked after reaching its threshold.
+func (t *LoginThrottle) LockoutDuration() time.Duration {
+	return t.cfg.LockoutDuration
+}
+
+// RetryAfter returns how long the caller must wait before another attempt for username from ip, or 0.
+func (t *LoginThrottle) RetryAfter(username, ip string) time.Duration {
+	wait := t.AccountRetryAfter(username)
+	if ipWait := t.IPRetryAfter(ip); ipWait > wait {
+		wait = ipWait
+	}
+	return wait
+}
+
+// AccountRetryAfter returns how long the caller must wait before another attempt for username, or 0.
+func (t *LoginThrottle) AccountRetryAfter(username string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.waitLocked(t.accounts, username, time.Now())
+}
+
+// IPRetryAfter returns how long the caller must wait before another attempt from ip, or 0.
+func (t *LoginThrottle) IPRetryAfter(ip string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.waitLocked(t.ips, ip, time.Now())
+}
+
+// RecordFailure counts a failed attempt. It reports whether the account or
+// the IP has just reached its lockout threshold, so the caller can record it.
+func (t *LoginThrottle) RecordFailure(username, ip string) (accountLocked bool, ipLocked bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.sweepLocked(now)
+	account := t.counterLocked(t.accounts, username, now)
+	account.failures++
+	account.lastFailure = now
+	account.blockedTill = now.Add(t.delay(account.failures))
+
+	ipLocked = t.recordIPLocked(ip, now)
+	return account.failures == t.cfg.AccountMaxFailures, ipLocked
+}
+
+// RecordIPFailure counts a failed attempt from ip without charging any account.
+// It reports whether the IP has just reached its lockout threshold.
+func (t *LoginThrottle) RecordIPFailure(ip string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.sweepLocked(now)
+	return t.recordIPLocked(ip, now)
+}
+
+// recordIPLocked counts a failure of ip and blocks it once it reaches IPMaxFailures.
+func (t *LoginThrottle) recordIPLocked(ip string, now time.Time) bool {
+	counter := t.counterLocked(t.ips, ip, now)
+	counter.failures++
+	counter.lastFailure = now
+	if counter.failures >= t.cfg.IPMaxFailures {
+		counter.blockedTill = now.Add(t.cfg.LockoutDuration)
+	}
+	return counter.failures == t.cfg.IPMaxFailures
+}
+
+// RecordSuccess clears the failure count of an account after a successful login.
+func (t *LoginThrottle) RecordSuccess(username string) {
+	t.Reset(username)
+}
+
+// Reset clears the failure count of an account, e.g. when an admin unlocks it.
+func (t *LoginThrottle) Reset(username string) {
+	t.mu.Lock()
+	delete(t.accounts, username)
+	t.mu.Unlock()
+}
+
+// delay is the wait imposed after the given number of failures.
+func (t *LoginThrottle) delay(failures int) time.Duration {
+	if failures <= t.cfg.FreeAttempts {
+		return 0
+	}
+	delay := t.cfg.BaseDelay
+	for i := t.cfg.FreeAttempts + 1; i < failures && delay < t.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.cfg.MaxDelay {
+		delay = t.cfg.MaxDelay
+	}
+	return delay
+}
+
+func (t *LoginThrottle) waitLocked(counters map[string]*failureCounter, key string, now time.Time) time.Duration {
+	counter, ok := counters[key]
+	if !ok || !now.Before(counter.blockedTill) {
+		return 0
+	}
+	return counter.blockedTill.Sub(now)
+}
+
+// counterLocked returns the counter for key, starting over if the last failure is older than the window.
+func (t *LoginThrottle) counterLocked(counters map[string]*failureCounter, key string, now time.Time) *failureCounter {
+	counter, ok := counters[key]
+	if !ok || t.expired(counter, now) {
+		if !ok && t.cfg.MaxEntries > 0 && len(counters) >= t.cfg.MaxEntries {
+			evictLocked(counters, now)
+		}
+		counter = &failureCounter{}
+		counters[key] = counter
+	}
+	return counter
+}
+
+// expired reports whether counter has outlived the window and no longer blocks.
+func (t *LoginThrottle) expired(counter *failureCounter, now time.Time) bool {
+	return now.Sub(counter.lastFailure) > t.cfg.Window && !now.Before(counter.blockedTill)
+}
+
+// sweepLocked removes the expired counters, at most once per window.
+func (t *LoginThrottle) sweepLocked(now time.Time) {
+	if now.Sub(t.lastSweep) < t.cfg.Window {
+		return
+	}
+	t.lastSweep = now
+	for _, counters := range []map[string]*failureCounter{t.accounts, t.ips} {
+		for key, counter := range counters {
+			if t.expired(counter, now) {
+				delete(counters, key)
+			}
+		}
+	}
+}
+
+// evictLocked makes room in a full map by removing one counter, preferring one that does
+// not block anyone right now. Map iteration order is random, so attackers cannot choose
+// which counter goes.
+func evictLocked(counters map[string]*failureCounter, now time.Time) {
+	victim := ""
+	found := false
+	for key, counter := range counters {
+		if !found {
+			victim, found = key, true
+		}
+		if !now.Before(counter.blockedTill) {
+			victim = key
+			break
+		}
+	}
+	if found {
+		delete(counters, victim)
+	}
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func testThrottleConfig() ThrottleConfig {
+	return ThrottleConfig{
+		FreeAttempts:       3,
+		BaseDelay:          time.Second,
+		MaxDelay:           8 * time.Second,
+		AccountMaxFailures: 10,
+		IPMaxFailures:      20,
+		LockoutDuration:    15 * time.Minute,
+		Window:             15 * time.Minute,
+		MaxEntries:         100,
+	}
+}
+
+func TestLoginThrottleDelay(t *testing.T) {
+	throttle := NewLoginThrottle(testThrottleConfig())
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{8, 8 * time.Second},
+		{50, 8 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := throttle.delay(tt.failures); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginThrottleRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		// retry checks a different username or IP than the one that failed
+		otherUser, otherIP bool
+		wantWait           bool
+	}{
+		{"free attempts", 3, false, false, false},
+		{"delayed after free attempts", 4, false, false, true},
+		{"delay applies from any IP", 4, false, true, true},
+		{"other accounts unaffected", 4, true, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := NewLoginThrottle(testThrottleConfig())
+			for i := 0; i < tt.failures; i++ {
+				throttle.RecordFailure("somchai", "192.0.2.1")
+			}
+			username, ip := "somchai", "192.0.2.1"
+			if tt.otherUser {
+				username = "malee"
+			}
+			if tt.otherIP {
+				ip = "192.0.2.2"
+			}
+			if wait := throttle.RetryAfter(username, ip); (wait > 0) != tt.wantWait {
+				t.Errorf("RetryAfter = %v, want wait: %v", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleLockout(t *testing.T) {
+	cfg := testThrottleConfig()
+	throttle := NewLoginThrottle(cfg)
+
+	for i := 1; i <= cfg.AccountMaxFailures; i++ {
+		accountLocked, _ := throttle.RecordFailure("somchai", fmt.Sprintf("192.0.2.%d", i))
+		if want := i == cfg.AccountMaxFailures; accountLocked != want {
+			t.Errorf("failure %d: accountLocked = %v, want %v", i, accountLocked, want)
+		}
+	}
+
+	throttle.RecordSuccess("somchai")
+	if wait := throttle.AccountRetryAfter("somchai"); wait != 0 {
+		t.Errorf("AccountRetryAfter after success = %v, want 0", wait)
+	}
+}
+
+func TestLoginThrottleIPBlock(t *testing.T) {
+	cfg := testThrottleConfig()
+	throttle := NewLoginThrottle(cfg)
+
+	for i := 1; i <= cfg.IPMaxFailures; i++ {
+		_, ipLocked := throttle.RecordFailure(fmt.Sprintf("user%d", i), "192.0.2.1")
+		if want := i == cfg.IPMaxFailures; ipLocked != want {
+			t.Errorf("failure %d: ipLocked = %v, want %v", i, ipLocked, want)
+		}
+	}
+	if wait := throttle.IPRetryAfter("192.0.2.1"); wait <= cfg.LockoutDuration-time.Minute {
+		t.Errorf("IPRetryAfter = %v, want about %v", wait, cfg.LockoutDuration)
+	}
+	// Other addresses and accounts are not blocked with it
+	if wait := throttle.RetryAfter("fresh", "192.0.2.2"); wait != 0 {
+		t.Errorf("RetryAfter for another user and IP = %v, want 0", wait)
+	}
+}
+
+func TestLoginThrottleMaxEntries(t *testing.T) {
+	cfg := testThrottleConfig()
+	cfg.MaxEntries = 5
+	throttle := NewLoginThrottle(cfg)
+
+	for i := 0; i < 50; i++ {
+		throttle.RecordFailure(fmt.Sprintf("user%d", i), fmt.Sprintf("192.0.2.%d", i))
+	}
+	if len(throttle.accounts) > cfg.MaxEntries || len(throttle.ips) > cfg.MaxEntries {
+		t.Errorf("kept %d accounts and %d IPs, want at most %d each", len(throttle.accounts), len(throttle.ips), cfg.MaxEntries)
+	}
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TicketStore keeps short-lived, single-use tickets that let a client open a
+// WebSocket without putting its JWT in the URL. A ticket is issued to an
+// already authenticated caller and carries that caller's claims.
+type TicketStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	tickets map[string]ticketEntry
+}
+
+type ticketEntry struct {
+	claims    *CustomClaims
+	expiresAt time.Time
+}
+
+// NewTicketStore creates a TicketStore whose tickets expire after ttl.
+func NewTicketStore(ttl time.Duration) *TicketStore {
+	return &TicketStore{
+		ttl:     ttl,
+		tickets: make(map[string]ticketEntry),
+	}
+}
+
+// Issue creates a new ticket bound to claims and returns it with its expiry time.
+func (s *TicketStore) Issue(claims *CustomClaims) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate ticket: %w", err)
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(buf)
+	expiresAt := time.Now().Add(s.ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purgeExpiredLocked()
+	s.tickets[ticket] = ticketEntry{claims: claims, expiresAt: expiresAt}
+	return ticket, expiresAt, nil
+}
+
+// Redeem consumes a ticket. It returns the claims it was issued for, or false
+// if the ticket is unknown, already used or expired.
+func (s *TicketStore) Redeem(ticket string) (*CustomClaims, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.tickets[ticket]
+	if !ok {
+		return nil, false
+	}
+	delete(s.tickets, ticket) // Single use, even if expired
+	if time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.claims, true
+}
+
+func (s *TicketStore) purgeExpiredLocked() {
+	now := time.Now()
+	for ticket, entry := range s.tickets {
+		if now.After(entry.expiresAt) {
+			delete(s.tickets, ticket)
+		}
+	}
+}
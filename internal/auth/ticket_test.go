@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTicketStoreRedeem(t *testing.T) {
+	claims := &CustomClaims{Username: "somchai", Role: RoleKitchen}
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		redeems int // redemptions before the one checked
+		ticket  string
+		wantOK  bool
+	}{
+		{"fresh ticket", time.Minute, 0, "", true},
+		{"second redemption", time.Minute, 1, "", false},
+		{"expired ticket", -time.Second, 0, "", false},
+		{"unknown ticket", time.Minute, 0, "not-a-ticket", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewTicketStore(tt.ttl)
+			ticket, _, err := store.Issue(claims)
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+			if tt.ticket != "" {
+				ticket = tt.ticket
+			}
+			for i := 0; i < tt.redeems; i++ {
+				store.Redeem(ticket)
+			}
+
+			got, ok := store.Redeem(ticket)
+			if ok != tt.wantOK {
+				t.Fatalf("Redeem ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got != claims {
+				t.Errorf("Redeem returned %+v, want the issued claims", got)
+			}
+		})
+	}
+}
+
+func TestTicketStoreIssuesDistinctTickets(t *testing.T) {
+	store := NewTicketStore(time.Minute)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		ticket, _, err := store.Issue(&CustomClaims{Username: "somchai"})
+		if err != nil {
+			t.Fatalf("Issue: %v", err)
+		}
+		if seen[ticket] {
+			t.Fatalf("ticket %s issued twice", ticket)
+		}
+		seen[ticket] = true
+	}
+}
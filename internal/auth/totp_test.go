@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 test key of RFC 6238 appendix B ("12345678901234567890"), base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8-digit codes; ours are their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		code, err := TOTPCode(rfc6238Secret, tt.unix/totpPeriod)
+		if err != nil {
+			t.Fatalf("TOTPCode(%d): %v", tt.unix, err)
+		}
+		if code != tt.code {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+	codeAt := func(step int64) string {
+		code, err := TOTPCode(rfc6238Secret, step)
+		if err != nil {
+			t.Fatalf("TOTPCode(%d): %v", step, err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfc6238Secret, codeAt(step), step, true},
+		{"previous step", rfc6238Secret, codeAt(step - 1), step - 1, true},
+		{"next step", rfc6238Secret, codeAt(step + 1), step + 1, true},
+		{"two steps old", rfc6238Secret, codeAt(step - 2), 0, false},
+		{"spaces ignored", rfc6238Secret, " " + codeAt(step)[:3] + " " + codeAt(step)[3:], step, true},
+		{"lower-case secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", codeAt(step), step, true},
+		{"too short", rfc6238Secret, codeAt(step)[:5], 0, false},
+		{"wrong code", rfc6238Secret, "000000", 0, false},
+		{"invalid secret", "not base32!", codeAt(step), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := VerifyTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("VerifyTOTP = (%d, %v), want (%d, %v)", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
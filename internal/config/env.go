@@ -0,0 +1,70 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetEnv returns the value of the environment variable key, or fallback when it is unset or empty.
+func GetEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// GetEnvBool parses the environment variable key as a boolean ("true", "1", "false", "0", ...).
+func GetEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("⚠️ Invalid boolean for %s=%q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// GetEnvInt parses the environment variable key as an integer.
+func GetEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("⚠️ Invalid integer for %s=%q, using default %d", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// GetEnvDuration parses the environment variable key as a time.Duration (e.g. "30s", "15m").
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("⚠️ Invalid duration for %s=%q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// GetEnvList splits a comma-separated environment variable into trimmed, non-empty values.
+func GetEnvList(key string) []string {
+	var values []string
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
@@ -0,0 +1,284 @@
+// Package fieldcrypt encrypts personal data columns at rest with AES-256-GCM and computes
+// blind indexes, keyed HMACs that allow equality lookups on encrypted columns.
+//
+// Keys are versioned: FIELD_ENCRYPTION_KEYS lists every data-encryption key as
+// "id:base64key" pairs, FIELD_ENCRYPTION_ACTIVE_KEY picks the one that encrypts new
+// values (default: the first), and the others only decrypt. Each ciphertext names
+// its key, so keys can be rotated by adding a new active key and re-encrypting.
+// BLIND_INDEX_KEY is the separate key of the blind indexes.
+package fieldcrypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"order-notification-system/internal/config"
+
+	"gorm.io/gorm/schema"
+)
+
+// prefix marks an encrypted value: "enc:<key id>:<base64 nonce and ciphertext>".
+// Values without it are plaintext written before encryption was enabled.
+const prefix = "enc:"
+
+// KeySize is the size in bytes of data-encryption and blind index keys.
+const KeySize = 32
+
+var (
+	// ErrNotInitialized is returned when a value is encrypted or decrypted before Init.
+	ErrNotInitialized = errors.New("field encryption keys are not loaded")
+	// ErrUnknownKey is returned for a value encrypted with a key that is not configured.
+	ErrUnknownKey = errors.New("value is encrypted with an unknown key")
+)
+
+// Keyring holds the data-encryption keys and the blind index key.
+type Keyring struct {
+	active   string
+	aeads    map[string]cipher.AEAD
+	ids      []string // in configuration order
+	indexKey []byte
+}
+
+var (
+	mu      sync.RWMutex
+	keyring *Keyring
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+// Init loads the keys from the environment. Call it after the environment is loaded.
+func Init() error {
+	ring, err := LoadKeyring(config.GetEnvList("FIELD_ENCRYPTION_KEYS"),
+		config.GetEnv("FIELD_ENCRYPTION_ACTIVE_KEY", ""), config.GetEnv("BLIND_INDEX_KEY", ""))
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	keyring = ring
+	mu.Unlock()
+	return nil
+}
+
+// LoadKeyring parses "id:base64key" entries and a base64 blind index key.
+// active names the key that encrypts; when empty, the first entry does.
+func LoadKeyring(entries []string, active, indexKey string) (*Keyring, error) {
+	if len(entries) == 0 {
+		return nil, errors.New("FIELD_ENCRYPTION_KEYS is not set; generate a key with 'go run ./cmd/fieldcrypt genkey'")
+	}
+	ring := &Keyring{aeads: make(map[string]cipher.AEAD, len(entries))}
+	for _, entry := range entries {
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || strings.Contains(encoded, ":") {
+			return nil, fmt.Errorf("field encryption key %q must be written as id:base64key", truncate(entry))
+		}
+		if _, exists := ring.aeads[id]; exists {
+			return nil, fmt.Errorf("duplicate field encryption key id %q", id)
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("field encryption key %s: %w", id, err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("field encryption key %s: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("field encryption key %s: %w", id, err)
+		}
+		ring.aeads[id] = aead
+		ring.ids = append(ring.ids, id)
+	}
+
+	ring.active = active
+	if ring.active == "" {
+		ring.active = ring.ids[0]
+	}
+	if _, ok := ring.aeads[ring.active]; !ok {
+		return nil, fmt.Errorf("FIELD_ENCRYPTION_ACTIVE_KEY %q is not in FIELD_ENCRYPTION_KEYS", ring.active)
+	}
+
+	if indexKey == "" {
+		return nil, errors.New("BLIND_INDEX_KEY is not set; generate a key with 'go run ./cmd/fieldcrypt genkey'")
+	}
+	key, err := decodeKey(indexKey)
+	if err != nil {
+		return nil, fmt.Errorf("BLIND_INDEX_KEY: %w", err)
+	}
+	ring.indexKey = key
+	return ring, nil
+}
+
+// decodeKey decodes a base64 key and checks its size.
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.New("key is not valid base64")
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// NewKey returns a random key, base64 encoded.
+func NewKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func current() (*Keyring, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if keyring == nil {
+		return nil, ErrNotInitialized
+	}
+	return keyring, nil
+}
+
+// ActiveKeyID returns the id of the key that encrypts new values.
+func ActiveKeyID() (string, error) {
+	ring, err := current()
+	if err != nil {
+		return "", err
+	}
+	return ring.active, nil
+}
+
+// Encrypt encrypts plaintext with the active key. column (e.g. "users.email") is bound to the
+// ciphertext as associated data, so a value copied to another column does not decrypt.
+// An empty plaintext stays empty.
+func Encrypt(column, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	ring, err := current()
+	if err != nil {
+		return "", err
+	}
+	aead := ring.aeads[ring.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(column))
+	return prefix + ring.active + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt. Values that are not encrypted are returned unchanged.
+func Decrypt(column, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	ring, err := current()
+	if err != nil {
+		return "", err
+	}
+	id, encoded, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	aead, ok := ring.aeads[id]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value in %s", column)
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(column))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", column, err)
+	}
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether value was produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID returns the id of the key value is encrypted with, or "" for a plaintext value.
+func KeyID(value string) string {
+	if !IsEncrypted(value) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id
+}
+
+// BlindIndex returns the hex HMAC-SHA256 of a normalized value for column, or "" for an
+// empty value. Equal values give equal indexes, so lookups compare indexes instead of plaintext.
+func BlindIndex(column, normalized string) (string, error) {
+	if normalized == "" {
+		return "", nil
+	}
+	ring, err := current()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, ring.indexKey)
+	mac.Write([]byte(column))
+	mac.Write([]byte{0})
+	mac.Write([]byte(normalized))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Serializer stores a string field encrypted. Tag a field with gorm:"serializer:encrypted";
+// the column name is used as associated data. Updates with a map bypass serializers,
+// so such values must be passed through Encrypt by the caller.
+type Serializer struct{}
+
+// Scan decrypts the database value into the field.
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return fmt.Errorf("unsupported type %T for encrypted column %s", dbValue, field.DBName)
+	}
+	plaintext, err := Decrypt(ColumnName(field.Schema.Table, field.DBName), value)
+	if err != nil {
+		return err
+	}
+	return field.Set(ctx, dst, plaintext)
+}
+
+// Value encrypts the field for the database.
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plaintext, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("encrypted column %s must be a string, got %T", field.DBName, fieldValue)
+	}
+	return Encrypt(ColumnName(field.Schema.Table, field.DBName), plaintext)
+}
+
+// ColumnName is the associated data of a column: "table.column".
+func ColumnName(table, column string) string {
+	return table + "." + column
+}
+
+// truncate shortens a config entry for an error message so a key is not logged in full.
+func truncate(entry string) string {
+	if len(entry) > 8 {
+		return entry[:8] + "..."
+	}
+	return entry
+}
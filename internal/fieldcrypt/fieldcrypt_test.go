@@ -0,0 +1,217 @@
+package fieldcrypt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// useTestKeys installs a keyring with the given key ids, the first one active, for the duration of t.
+func useTestKeys(t *testing.T, active string, ids ...string) {
+	t.Helper()
+	entries := make([]string, 0, len(ids))
+	for _, id := range ids {
+		key, err := NewKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, id+":"+key)
+	}
+	indexKey, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring, err := LoadKeyring(entries, active, indexKey)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+
+	mu.Lock()
+	previous := keyring
+	keyring = ring
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		keyring = previous
+		mu.Unlock()
+	})
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	useTestKeys(t, "k1", "k1")
+	tests := []struct {
+		name      string
+		plaintext string
+	}{
+		{"ascii", "somchai@example.com"},
+		{"thai", "สมชาย ใจดี"},
+		{"long", strings.Repeat("x", 4096)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := Encrypt("users.email", tt.plaintext)
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			if !IsEncrypted(encrypted) || KeyID(encrypted) != "k1" {
+				t.Errorf("Encrypt = %q, want an enc: value with key k1", encrypted)
+			}
+			if strings.Contains(encrypted, tt.plaintext) {
+				t.Errorf("ciphertext contains the plaintext")
+			}
+			decrypted, err := Decrypt("users.email", encrypted)
+			if err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+			if decrypted != tt.plaintext {
+				t.Errorf("Decrypt = %q, want %q", decrypted, tt.plaintext)
+			}
+
+			again, err := Encrypt("users.email", tt.plaintext)
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			if again == encrypted {
+				t.Errorf("encrypting twice gave the same ciphertext")
+			}
+		})
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	useTestKeys(t, "k1", "k1")
+	encrypted, err := Encrypt("users.email", "somchai@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a character in the middle of the ciphertext, away from the padding bits at the end
+	tampered := []byte(encrypted)
+	middle := len(tampered) - 20
+	if tampered[middle] == 'A' {
+		tampered[middle] = 'B'
+	} else {
+		tampered[middle] = 'A'
+	}
+
+	tests := []struct {
+		name    string
+		column  string
+		value   string
+		want    string
+		wantErr bool
+		// wantIs, if set, is the error the failure must wrap
+		wantIs error
+	}{
+		{"encrypted value", "users.email", encrypted, "somchai@example.com", false, nil},
+		{"plaintext passes through", "users.email", "legacy@example.com", "legacy@example.com", false, nil},
+		{"empty", "users.email", "", "", false, nil},
+		{"copied to another column", "users.phone_number", encrypted, "", true, nil},
+		{"unknown key", "users.email", "enc:k9:" + strings.SplitN(encrypted, ":", 3)[2], "", true, ErrUnknownKey},
+		{"malformed", "users.email", "enc:k1:!!!", "", true, nil},
+		{"tampered", "users.email", string(tampered), "", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decrypt(tt.column, tt.value)
+			if !tt.wantErr {
+				if err != nil || got != tt.want {
+					t.Errorf("Decrypt = (%q, %v), want (%q, nil)", got, err, tt.want)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Decrypt = %q, want an error", got)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("Decrypt error = %v, want %v", err, tt.wantIs)
+			}
+		})
+	}
+}
+
+func TestDecryptWithRotatedKeys(t *testing.T) {
+	useTestKeys(t, "old", "old", "new")
+	encrypted, err := Encrypt("users.email", "somchai@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// "new" becomes active; values under "old" still decrypt while it is listed
+	mu.Lock()
+	keyring.active = "new"
+	mu.Unlock()
+	if got, err := Decrypt("users.email", encrypted); err != nil || got != "somchai@example.com" {
+		t.Errorf("Decrypt after rotation = (%q, %v)", got, err)
+	}
+	rotated, err := Encrypt("users.email", "somchai@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if KeyID(rotated) != "new" {
+		t.Errorf("KeyID of a new value = %q, want new", KeyID(rotated))
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	useTestKeys(t, "k1", "k1")
+	index := func(column, value string) string {
+		t.Helper()
+		got, err := BlindIndex(column, value)
+		if err != nil {
+			t.Fatalf("BlindIndex: %v", err)
+		}
+		return got
+	}
+
+	email := index("users.email", "somchai@example.com")
+	if len(email) != 64 {
+		t.Errorf("BlindIndex = %q, want 64 hex characters", email)
+	}
+	tests := []struct {
+		name      string
+		got       string
+		wantEqual bool
+	}{
+		{"same value and column", index("users.email", "somchai@example.com"), true},
+		{"other value", index("users.email", "malee@example.com"), false},
+		{"other column", index("users.phone_number", "somchai@example.com"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.got == email) != tt.wantEqual {
+				t.Errorf("index equal = %v, want %v", tt.got == email, tt.wantEqual)
+			}
+		})
+	}
+	if got := index("users.email", ""); got != "" {
+		t.Errorf("BlindIndex of empty value = %q, want empty", got)
+	}
+}
+
+func TestLoadKeyringRejectsBadConfig(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		entries  []string
+		active   string
+		indexKey string
+	}{
+		{"no keys", nil, "", key},
+		{"missing id", []string{":" + key}, "", key},
+		{"duplicate id", []string{"k1:" + key, "k1:" + key}, "", key},
+		{"short key", []string{"k1:c2hvcnQ="}, "", key},
+		{"unknown active key", []string{"k1:" + key}, "k2", key},
+		{"no blind index key", []string{"k1:" + key}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadKeyring(tt.entries, tt.active, tt.indexKey); err == nil {
+				t.Errorf("LoadKeyring succeeded, want an error")
+			}
+		})
+	}
+}
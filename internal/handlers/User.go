@@ -5,21 +5,31 @@ import (
 	"fmt"
 	"log"      // Import for logging
 	"net/http" // Import errors package
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/auth"
+	"order-notification-system/internal/i18n"
+	"order-notification-system/internal/mail"
+	"order-notification-system/internal/middleware"
 	"order-notification-system/internal/models"
+	"order-notification-system/internal/validation"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm" // Import gorm for gorm.ErrRecordNotFound
 )
 
 // UserHandler holds dependencies for user-related handlers.
 type UserHandler struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Mailer mail.Sender
+
+	// VerificationThrottle spaces out verification emails per account
+	VerificationThrottle *auth.LoginThrottle
 }
 
 // NewUserHandler creates a new UserHandler instance.
-func NewUserHandler(db *gorm.DB) *UserHandler {
-	return &UserHandler{DB: db}
+func NewUserHandler(db *gorm.DB, mailer mail.Sender, verificationThrottle *auth.LoginThrottle) *UserHandler {
+	return &UserHandler{DB: db, Mailer: mailer, VerificationThrottle: verificationThrottle}
 }
 
 // GetRemark provides a simple remark.
@@ -30,78 +40,249 @@ func (h *UserHandler) GetRemark(c *gin.Context) {
 
 	str := `
 Available API Endpoints:
+Messages are in English or Thai; send "Accept-Language: th" or set "language" on your account.
 
 Public Routes:
   General Remark (This Page):
     GET %s/api/
   User Registration:
     POST %s/api/users
-      Body (JSON): {"username": "newuser", "password": "password123", "prefix": "Mr.", "first_name": "John", "last_name": "Doe", "email": "john.doe@example.com", "phone_number": "1234567890", "date_of_birth": "YYYY-MM-DD"}
+      Body (JSON): {"username": "newuser", "password": "password123", "prefix": "Mr.", "first_name": "John", "last_name": "Doe", "email": "john.doe@example.com", "phone_number": "1234567890", "date_of_birth": "YYYY-MM-DD", "language": "th"}
+  Verify Email (link sent on registration):
+    GET %s/api/email/verify?token=TOKEN
   User Login:
     POST %s/api/login
       Body (JSON): {"username": "existinguser", "password": "password123"}
-  Create Order:
+      Returns a short-lived access token and a refresh token, or an mfa_token if a second factor is needed
+  Login Second Step:
+    POST %s/api/login/2fa
+      Body (JSON): {"mfa_token": "MFA_TOKEN", "code": "123456"} or {"mfa_token": "MFA_TOKEN", "recovery_code": "abcde-fghij"}
+  Enrol During Login (when your role requires two-factor authentication):
+    POST %s/api/login/2fa/enroll
+      Body (JSON): {"mfa_token": "MFA_TOKEN"}
+    POST %s/api/login/2fa/confirm
+      Body (JSON): {"mfa_token": "MFA_TOKEN", "code": "123456"}
+  Refresh Token (rotates the refresh token; reusing an old one revokes the session):
+    POST %s/api/token/refresh
+      Body (JSON): {"refresh_token": "REFRESH_TOKEN"}
+  Forgot Password (emails a single-use reset link):
+    POST %s/api/password/forgot
+      Body (JSON): {"username": "existinguser"} or {"email": "john.doe@example.com"}
+  Reset Password:
+    POST %s/api/password/reset
+      Body (JSON): {"token": "TOKEN_FROM_EMAIL", "new_password": "newpassword123"}
+  Create Order (send a Bearer token to receive inbox notifications for it):
     POST %s/order
       Body (JSON): {"item_code": "IC001", "item": "Sample Item", "quantity": 2, "price": 25.50, "image": "http://example.com/image.jpg"}
 
-Protected Routes (Require JWT Bearer Token in 'Authorization' Header, or 'token' query param for WebSocket):
+Protected Routes (Require JWT Bearer Token in 'Authorization' Header):
   Get User Profile:
     GET %s/api/profile
-  Get User by Username:
+  User Administration (requires users:manage):
+    GET %s/api/users?q=somchai&role=customer&status=active&sort=-created_at&limit=20&offset=0
+    POST %s/api/users/:username/suspend
+      Body (JSON, optional): {"reason": "Chargeback fraud"}
+    POST %s/api/users/:username/reactivate
+    PUT %s/api/users/:username/role
+      Body (JSON): {"role": "kitchen"} (admin, manager, kitchen, cashier, customer)
+  Get User by Username (the user themselves or users:manage):
     GET %s/api/users/:username (e.g., /api/users/testuser)
-  Update User:
-    PUT %s/api/users/:username (e.g., /api/users/testuser)
-      Body (JSON): {"prefix": "Ms.", "first_name": "Jane"} (fields to update)
-  Delete User:
+  Update User (self or users:manage; only the fields sent are changed):
+    PATCH %s/api/users/:username (e.g., /api/users/testuser)
+      Body (JSON): {"first_name": "Jane", "phone_number": "+66812345678", "date_of_birth": "1990-04-13"}
+  Delete User (self or users:manage; orders are kept under a pseudonym):
     DELETE %s/api/users/:username (e.g., /api/users/testuser)
+  Export Your Data (self or users:manage):
+    GET %s/api/users/:username/export?format=json (or format=zip)
+  Erase Your Data (self or users:manage; orders are kept under a pseudonym):
+    POST %s/api/users/:username/erase
+      Body (JSON): {"password": "password123"} for yourself, or {"reason": "PDPA request #42"} on behalf of a user
+  Privacy Request Log (requires users:manage):
+    GET %s/api/privacy-requests?username=erased-1a2b3c4d5e6f&limit=20&offset=0
+  Change Password (own account only; ends every session):
+    PUT %s/api/users/:username/password
+      Body (JSON): {"current_password": "password123", "new_password": "newpassword456"}
+  Log Out (current session):
+    POST %s/api/logout
+  Log Out Everywhere (all sessions):
+    POST %s/api/logout/all
+  Revoke All Sessions of a User (requires users:manage):
+    DELETE %s/api/users/:username/sessions
+  Unlock a Locked-Out Account (requires users:manage):
+    POST %s/api/users/:username/unlock
+  Resend Email Verification Link (max once a minute, 5 per hour):
+    POST %s/api/email/verification/resend
+  Mark a User's Email as Verified (requires users:manage):
+    POST %s/api/users/:username/verify-email
+  Two-Factor Authentication:
+    GET %s/api/2fa
+    POST %s/api/2fa/enroll
+    POST %s/api/2fa/confirm
+      Body (JSON): {"code": "123456"}
+    POST %s/api/2fa/recovery-codes
+      Body (JSON): {"code": "123456"}
+    DELETE %s/api/2fa
+      Body (JSON): {"password": "password123", "code": "123456"}
+  Reset a User's Two-Factor Authentication (requires users:manage):
+    DELETE %s/api/users/:username/2fa
+  API Keys for Machine Clients (requires apikeys:manage; send keys as "X-API-Key: KEY"):
+    GET %s/api/apikeys
+    POST %s/api/apikeys
+      Body (JSON): {"name": "front-counter-pos", "role": "cashier", "scopes": ["orders:view"], "allowed_ips": ["10.0.5.0/24"], "expires_at": "2026-01-01T00:00:00Z"}
+    DELETE %s/api/apikeys/:id
+  Get WebSocket Ticket (single use, short-lived):
+    POST %s/api/ws/ticket
+  WebSocket Connection Stats:
+    GET %s/api/ws/stats (requires system:stats)
+  Notification Inbox:
+    GET %s/api/notifications?unread=true&limit=20&offset=0
+    GET %s/api/notifications/unread-count
+    PUT %s/api/notifications/:id/read (mark read)
+    DELETE %s/api/notifications/:id/read (mark unread)
+    POST %s/api/notifications/read
+      Body (JSON): {"ids": [1, 2], "read": true} (omit ids to mark all)
+  Announcements:
+    GET %s/api/announcements?station=grill
+    POST %s/api/announcements (requires announcements:publish)
+      Body (JSON): {"message": "Grill is down, stop taking steak orders", "severity": "warning", "audience": "station", "audience_value": "grill", "expires_at": "2025-01-01T18:00:00Z"}
+    POST %s/api/announcements/:id/dismiss
+  Product Translations (requires products:manage):
+    PUT %s/api/products/:id/translations/:lang (e.g., /api/products/P001/translations/th)
+      Body (JSON): {"name": "ข้าวผัดกุ้ง", "description": "ข้าวผัดกุ้งสด"}
+    DELETE %s/api/products/:id/translations/:lang
   Update Order Status:
-    PATCH %s/orders/:id/status (e.g., /orders/1/status)
-      Body (JSON): {"status": "Shipped"}
-  WebSocket Notifications:
-    GET %s/ws?token=YOUR_JWT_TOKEN (Upgrade to WebSocket)
+    PATCH %s/orders/:id/status (e.g., /orders/1/status) (requires orders:update)
+      Body (JSON): {"status": "preparing"} (pending, preparing, ready, completed, cancelled)
+  WebSocket Notifications (Upgrade to WebSocket), authenticate with one of:
+    GET %s/ws with header "Sec-WebSocket-Protocol: bearer, YOUR_JWT_TOKEN"
+    GET %s/ws?ticket=TICKET_FROM_/api/ws/ticket
+    GET %s/ws then send {"type": "auth", "token": "YOUR_JWT_TOKEN"} as the first message
 `
 	// Format the string with the baseURL
 	formattedStr := fmt.Sprintf(str,
 		baseURL, // General Remark
 		baseURL, // User Registration
+		baseURL, // Verify Email
 		baseURL, // User Login
+		baseURL, // Login Second Step
+		baseURL, // Login Enroll
+		baseURL, // Login Enroll Confirm
+		baseURL, // Refresh Token
+		baseURL, // Forgot Password
+		baseURL, // Reset Password
 		baseURL, // Create Order
 		baseURL, // Get User Profile
+		baseURL, // List Users
+		baseURL, // Suspend User
+		baseURL, // Reactivate User
+		baseURL, // Change Role
 		baseURL, // Get User by Username
 		baseURL, // Update User
 		baseURL, // Delete User
+		baseURL, // Export User Data
+		baseURL, // Erase User
+		baseURL, // Privacy Requests
+		baseURL, // Change Password
+		baseURL, // Logout
+		baseURL, // Logout All
+		baseURL, // Revoke User Sessions
+		baseURL, // Unlock Account
+		baseURL, // Resend Verification
+		baseURL, // Admin Verify Email
+		baseURL, // 2FA Status
+		baseURL, // 2FA Enroll
+		baseURL, // 2FA Confirm
+		baseURL, // 2FA Recovery Codes
+		baseURL, // 2FA Disable
+		baseURL, // 2FA Reset
+		baseURL, // List API Keys
+		baseURL, // Create API Key
+		baseURL, // Revoke API Key
+		baseURL, // WebSocket Ticket
+		baseURL, // WebSocket Stats
+		baseURL, // List Notifications
+		baseURL, // Unread Count
+		baseURL, // Mark Read
+		baseURL, // Mark Unread
+		baseURL, // Bulk Mark
+		baseURL, // List Announcements
+		baseURL, // Create Announcement
+		baseURL, // Dismiss Announcement
+		baseURL, // Save Product Translation
+		baseURL, // Delete Product Translation
 		baseURL, // Update Order Status
-		baseURL, // WebSocket
+		baseURL, // WebSocket (protocol header)
+		baseURL, // WebSocket (ticket)
+		baseURL, // WebSocket (auth frame)
 	)
 	c.String(http.StatusOK, formattedStr)
 }
 
+// CreateUserRequest is the body of POST /api/users.
+type CreateUserRequest struct {
+	Username    string `json:"username" binding:"required,username"`
+	Password    string `json:"password" binding:"required,max=1024"`
+	Prefix      string `json:"prefix" binding:"max=20"`
+	FirstName   string `json:"first_name" binding:"max=100"`
+	LastName    string `json:"last_name" binding:"max=100"`
+	Email       string `json:"email" binding:"omitempty,email,max=254"`
+	PhoneNumber string `json:"phone_number" binding:"omitempty,phone"`
+	DateOfBirth string `json:"date_of_birth" binding:"omitempty,birthdate"` // YYYY-MM-DD
+	Language    string `json:"language" binding:"omitempty,language"`
+}
+
 // CreateUser handles the creation of a new user.
 func (h *UserHandler) CreateUser(c *gin.Context) {
-	var user models.User
-	err := c.BindJSON(&user)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to parse JSON request"})
+	var req CreateUserRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+	user := models.User{
+		Username:      req.Username,
+		Password:      req.Password,
+		Prefix:        strings.TrimSpace(req.Prefix),
+		First_name:    strings.TrimSpace(req.FirstName),
+		Last_name:     strings.TrimSpace(req.LastName),
+		Email:         strings.TrimSpace(req.Email),
+		Phone_number:  validation.NormalizePhone(req.PhoneNumber),
+		Date_of_birth: strings.TrimSpace(req.DateOfBirth),
+		Language:      req.Language,
+	}
+	if err := validatePassword(user.Password, user.Username, user.Email); err != nil {
+		respondPasswordPolicy(c, "password", err)
 		return
 	}
-	fmt.Println(user.Password)
 	// Generate hashed password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 14)
+	hashedPassword, err := auth.HashPassword(user.Password)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate hashed password"})
+		apierror.Respond(c, apierror.Internal("Failed to generate hashed password").Wrap(err))
 		return
 	}
-	user.Password = string(hashedPassword)
+	user.Password = hashedPassword
+	// Self-registration always creates an unverified customer; staff roles are assigned by an admin
+	user.Role = auth.RoleCustomer
+	user.Status = models.UserStatusActive
+	user.EmailVerified = false
+	user.EmailVerifiedAt = nil
 
 	// Create user in database
 	err = models.CreateUser(h.DB, &user)
 	if err != nil {
-		fmt.Println(err.Error())
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		if apierror.IsUniqueViolation(err) {
+			validation.RespondField(c, "username", "unique", "is already taken")
+			return
+		}
+		apierror.Respond(c, apierror.FromDB(err, nil, "Failed to create user"))
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	if user.Email != "" {
+		if err := h.sendVerificationEmail(&user); err != nil {
+			log.Printf("Error sending verification email to '%s': %v", user.Username, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, NewSelfUserView(&user))
 }
 
 type TokenStatus struct {
@@ -115,12 +296,11 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 	// ตัวอย่าง: r.GET("/users/:username", middleware.JWTMiddleware(), handlers.GetUserByID)
 	// ที่นี่เราจะสมมติว่า middleware ได้ทำงานแล้วถ้า route ถูกตั้งค่าอย่างถูกต้อง
 
-	// เราจะใช้ c.Param("username") ถ้า route เป็น /users/:username
-	// หรือ c.Query("username") ถ้าเป็น /users?username=...
-	// จากโค้ดเดิมใช้ c.Query("Username")
-	username := c.Query("Username")
+	// ใช้ c.Param("username") เพราะ route เป็น /users/:username
+	// และ RequireSelfOrPermission ตรวจสิทธิ์จาก path parameter เดียวกันนี้
+	username := c.Param("username")
 	if username == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Username query parameter is required"})
+		apierror.Respond(c, apierror.BadRequest("Username path parameter is required"))
 		return
 	}
 
@@ -129,53 +309,11 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 	err := models.GetUserByID(h.DB, &user, username)
 	if err != nil {
 		// Use errors.Is for wrapped errors, checking for gorm.ErrRecordNotFound
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "User not found"})
-		} else {
-			// Log the detailed error on the server for unexpected errors
-			log.Printf("Error retrieving user '%s': %v", username, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to retrieve user: " + err.Error()})
-		}
-		return
-	}
-	c.JSON(http.StatusOK, user)
-}
-
-// UpdateUser handles updating user information.
-func (h *UserHandler) UpdateUser(c *gin.Context) {
-	var user models.User
-	// ควรใช้ path parameter สำหรับระบุ user ที่จะอัปเดต เช่น /users/:username
-	// หรือถ้าจะใช้ query parameter ก็ควรเป็น username
-	usernameParam := c.Param("username") // สมมติว่า route เป็น /users/:username
-	if usernameParam == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Username path parameter is required"})
-		return
-	}
-
-	// ดึงข้อมูล user เดิมเพื่อตรวจสอบว่ามีอยู่จริง (optional แต่เป็น good practice)
-	var existingUser models.User
-	err := models.GetUserByID(h.DB, &existingUser, usernameParam)
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "User to update not found"})
-		return
-	}
-
-	// Bind JSON จาก request body เข้าไปยัง user struct ที่จะใช้อัปเดต
-	if err := c.BindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON request for update"})
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrUserNotFound, "Failed to retrieve user"))
 		return
 	}
-
-	// ตรวจสอบว่า username ใน payload (ถ้ามี) ตรงกับ username ใน path parameter
-	// และตั้งค่า username ให้ถูกต้องก่อน save เพื่อป้องกันการเปลี่ยน username ผ่าน payload โดยไม่ตั้งใจ
-	user.Username = usernameParam // Ensure the username from path is used for update
-
-	err = models.UpdateUser(h.DB, &user) // เรียกใช้ models.UpdateUser ที่แก้ไขแล้ว
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to update user: " + err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "User updated successfully", "data": user})
+	claims, _ := middleware.GetClaims(c)
+	c.JSON(http.StatusOK, userViewFor(claims, &user))
 }
 
 // DeleteUser handles deleting a user.
@@ -183,22 +321,41 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 	// ควรใช้ path parameter เช่น /users/:username
 	username := c.Param("username") // สมมติว่า route เป็น /users/:username
 	if username == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Username path parameter is required"})
+		apierror.Respond(c, apierror.BadRequest("Username path parameter is required"))
 		return
 	}
 
 	// (Optional) ตรวจสอบว่า user มีอยู่จริงหรือไม่ก่อนลบ
 	var existingUser models.User
 	if err := models.GetUserByID(h.DB, &existingUser, username); errors.Is(err, gorm.ErrRecordNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "User to delete not found"})
+		apierror.Respond(c, apierror.ErrUserNotFound)
+		return
+	}
+	if existingUser.IsErased() {
+		apierror.Respond(c, apierror.ErrUserErased)
+		return
+	}
+	// Sessions are found through the refresh tokens, which the delete removes, so revoke them first
+	if err := revokeAllSessions(username); err != nil {
+		apierror.Respond(c, apierror.Internal("Failed to delete user").Wrap(err))
 		return
 	}
 
-	err := models.DeleteUser(h.DB, username) // เรียกใช้ models.DeleteUser ที่แก้ไขแล้ว
+	// Orders stay for accounting under a pseudonym, so whoever registers the username next does not get them
+	id, err := auth.NewTokenID()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to delete user: " + err.Error()})
+		apierror.Respond(c, apierror.Internal("Failed to delete user").Wrap(err))
+		return
+	}
+	err = models.DeleteUser(h.DB, username, "deleted-"+id[:12]) // เรียกใช้ models.DeleteUser ที่แก้ไขแล้ว
+	if err != nil {
+		if errors.Is(err, models.ErrUserErased) {
+			apierror.Respond(c, apierror.ErrUserErased)
+			return
+		}
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrUserNotFound, "Failed to delete user"))
 		return
 	}
 	// หากข้อมูลถูกลบสำเร็จ
-	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "User " + username + " has been deleted"})
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "User %s has been deleted", username)})
 }
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/auth"
+	"order-notification-system/internal/config"
+	"order-notification-system/internal/i18n"
+	"order-notification-system/internal/middleware"
+	"order-notification-system/internal/models"
+	"order-notification-system/internal/utils"
+	"order-notification-system/internal/validation"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AnnouncementHandler holds dependencies for announcement handlers.
+type AnnouncementHandler struct {
+	DB *gorm.DB
+}
+
+// NewAnnouncementHandler creates a new AnnouncementHandler instance.
+func NewAnnouncementHandler(db *gorm.DB) *AnnouncementHandler {
+	return &AnnouncementHandler{DB: db}
+}
+
+// CreateAnnouncementRequest is the body of POST /api/announcements.
+type CreateAnnouncementRequest struct {
+	Title         string     `json:"title" binding:"max=200"`
+	Message       string     `json:"message" binding:"required,notblank,max=2000"`
+	Severity      string     `json:"severity" binding:"max=20"`       // info (default), warning, critical
+	Audience      string     `json:"audience" binding:"max=20"`       // all (default), station, role
+	AudienceValue string     `json:"audience_value" binding:"max=50"` // station or role name
+	ExpiresAt     *time.Time `json:"expires_at"`                      // defaults to now + ANNOUNCEMENT_DEFAULT_TTL (12h)
+}
+
+// CreateAnnouncement stores an announcement and pushes it to connected staff screens.
+func (h *AnnouncementHandler) CreateAnnouncement(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+
+	var req CreateAnnouncementRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+
+	announcement := models.Announcement{
+		Title:         req.Title,
+		Message:       req.Message,
+		Severity:      strings.ToLower(req.Severity),
+		Audience:      strings.ToLower(req.Audience),
+		AudienceValue: strings.ToLower(strings.TrimSpace(req.AudienceValue)),
+		CreatedBy:     claims.Username,
+	}
+	if announcement.Severity == "" {
+		announcement.Severity = models.SeverityInfo
+	}
+	if announcement.Audience == "" {
+		announcement.Audience = models.AudienceAll
+	}
+	if !models.IsValidSeverity(announcement.Severity) {
+		validation.RespondField(c, "severity", "oneof", "must be one of: %s", "info, warning, critical")
+		return
+	}
+	if !models.IsValidAudience(announcement.Audience) {
+		validation.RespondField(c, "audience", "oneof", "must be one of: %s", "all, station, role")
+		return
+	}
+	if announcement.Audience != models.AudienceAll && announcement.AudienceValue == "" {
+		validation.RespondField(c, "audience_value", "required", "is required for station and role audiences")
+		return
+	}
+
+	if req.ExpiresAt != nil {
+		announcement.ExpiresAt = *req.ExpiresAt
+	} else {
+		announcement.ExpiresAt = time.Now().Add(config.GetEnvDuration("ANNOUNCEMENT_DEFAULT_TTL", 12*time.Hour))
+	}
+	if !announcement.ExpiresAt.After(time.Now()) {
+		validation.RespondField(c, "expires_at", "future", "must be in the future")
+		return
+	}
+
+	if err := models.CreateAnnouncement(h.DB, &announcement); err != nil {
+		log.Printf("Error creating announcement by '%s': %v", claims.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to create announcement"))
+		return
+	}
+
+	utils.NotifyAnnouncement(&announcement)
+	utils.DeliverAnnouncementToInboxes(h.DB, &announcement)
+	c.JSON(http.StatusCreated, gin.H{"status": "success", "data": announcement})
+}
+
+// ListAnnouncements returns the active announcements the caller has not dismissed.
+// Pass ?station= to include announcements addressed to that station.
+func (h *AnnouncementHandler) ListAnnouncements(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+
+	announcements, err := models.GetActiveAnnouncements(h.DB, claims.Username)
+	if err != nil {
+		log.Printf("Error listing announcements for '%s': %v", claims.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to retrieve announcements"))
+		return
+	}
+
+	station := strings.ToLower(strings.TrimSpace(c.Query("station")))
+	matching := []models.Announcement{}
+	for _, announcement := range announcements {
+		if announcement.Matches(station, auth.NormalizeRole(claims.Role)) {
+			matching = append(matching, announcement)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": matching})
+}
+
+// DismissAnnouncement hides an announcement for the caller on all of their screens.
+func (h *AnnouncementHandler) DismissAnnouncement(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("Announcement id must be a positive integer"))
+		return
+	}
+
+	if err := models.DismissAnnouncement(h.DB, uint(id), claims.Username); err != nil {
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrAnnouncementNotFound, "Failed to dismiss announcement"))
+		return
+	}
+
+	utils.NotifyUser(claims.Username, gin.H{"type": "announcement_dismissed", "id": id})
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "Announcement dismissed")})
+}
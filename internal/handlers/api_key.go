@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/auth"
+	"order-notification-system/internal/i18n"
+	"order-notification-system/internal/middleware"
+	"order-notification-system/internal/models"
+	"order-notification-system/internal/utils"
+	"order-notification-system/internal/validation"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// APIKeyHandler holds dependencies for the API key management handlers.
+type APIKeyHandler struct {
+	DB *gorm.DB
+}
+
+// NewAPIKeyHandler creates a new APIKeyHandler instance.
+func NewAPIKeyHandler(db *gorm.DB) *APIKeyHandler {
+	return &APIKeyHandler{DB: db}
+}
+
+// CreateAPIKeyRequest is the body of POST /api/apikeys.
+type CreateAPIKeyRequest struct {
+	Name       string     `json:"name" binding:"required,notblank,max=100"`
+	Role       string     `json:"role" binding:"required,max=20"`
+	Scopes     []string   `json:"scopes" binding:"max=50,dive,max=64"`      // permissions of the role to keep; empty keeps them all
+	AllowedIPs []string   `json:"allowed_ips" binding:"max=50,dive,max=64"` // IPs or CIDR ranges; empty allows any address
+	ExpiresAt  *time.Time `json:"expires_at"`                               // empty never expires
+}
+
+// CreateAPIKey issues a key for a machine client. The raw key is in the response only.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+
+	role := strings.ToLower(strings.TrimSpace(req.Role))
+	if !auth.IsValidRole(role) {
+		validation.RespondField(c, "role", "role", "must be a known role")
+		return
+	}
+	scopes := make([]string, 0, len(req.Scopes))
+	for i, scope := range req.Scopes {
+		scope = strings.TrimSpace(scope)
+		if !auth.HasPermission(role, auth.Permission(scope)) {
+			validation.RespondField(c, fmt.Sprintf("scopes[%d]", i), "scope", "is not granted by role %s", role)
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+	allowedIPs, err := auth.ParseIPAllowlist(req.AllowedIPs)
+	if err != nil {
+		validation.RespondField(c, "allowed_ips", "ip", "must contain only IP addresses or CIDR ranges")
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		validation.RespondField(c, "expires_at", "future", "must be in the future")
+		return
+	}
+
+	raw, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		log.Printf("Error generating API key: %v", err)
+		apierror.Respond(c, apierror.Internal("Failed to create API key"))
+		return
+	}
+	key := models.APIKey{
+		Name:       strings.TrimSpace(req.Name),
+		Prefix:     prefix,
+		KeyHash:    hash,
+		Role:       role,
+		Scopes:     strings.Join(scopes, ","),
+		AllowedIPs: strings.Join(allowedIPs, ","),
+		ExpiresAt:  req.ExpiresAt,
+		CreatedBy:  claims.Username,
+	}
+	if err := models.CreateAPIKey(h.DB, &key); err != nil {
+		log.Printf("Error creating API key: %v", err)
+		apierror.Respond(c, apierror.Internal("Failed to create API key"))
+		return
+	}
+	middleware.LogSecurityEvent(c, "api_key_created", key.Prefix)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": i18n.T(c, "Store this key now; it cannot be shown again"),
+		"key":     raw,
+		"data":    key,
+	})
+}
+
+// ListAPIKeys returns every API key without the key material.
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := models.ListAPIKeys(h.DB)
+	if err != nil {
+		log.Printf("Error listing API keys: %v", err)
+		apierror.Respond(c, apierror.Internal("Failed to retrieve API keys"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": keys})
+}
+
+// RevokeAPIKey revokes a key immediately and drops its WebSocket connections.
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("Invalid API key ID"))
+		return
+	}
+
+	key, err := models.RevokeAPIKey(h.DB, uint(id))
+	if err != nil {
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrAPIKeyNotFound, "Failed to revoke API key"))
+		return
+	}
+	utils.DisconnectUser(auth.APIKeyUsername(key.Prefix))
+	middleware.LogSecurityEvent(c, "api_key_revoked", key.Prefix)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "API key %s revoked", key.Prefix)})
+}
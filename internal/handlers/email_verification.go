@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/auth"
+	"order-notification-system/internal/config"
+	"order-notification-system/internal/i18n"
+	"order-notification-system/internal/mail"
+	"order-notification-system/internal/middleware"
+	"order-notification-system/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sendVerificationEmail emails user a signed link to EMAIL_VERIFICATION_URL, valid for EMAIL_VERIFICATION_TTL (default 48h).
+func (h *UserHandler) sendVerificationEmail(user *models.User) error {
+	ttl := config.GetEnvDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour)
+	token, err := auth.NewEmailVerificationToken(user.Username, user.Email, ttl)
+	if err != nil {
+		return err
+	}
+	link := config.GetEnv("EMAIL_VERIFICATION_URL", "http://localhost:8080/api/email/verify") + "?token=" + url.QueryEscape(token)
+	return h.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nPlease confirm your email address by opening the link below. It expires in %v.\n\n%s\n",
+			user.Username, ttl, link),
+	})
+}
+
+// errInvalidVerificationLink is returned for a bad, expired or outdated verification link.
+var errInvalidVerificationLink = apierror.New(http.StatusBadRequest, apierror.CodeInvalidToken, "Invalid or expired verification link")
+
+// VerifyEmail marks the email in a verification link as verified.
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+	username, email, err := auth.ParseEmailVerificationToken(c.Query("token"))
+	if err != nil {
+		apierror.Respond(c, errInvalidVerificationLink)
+		return
+	}
+
+	if err := models.MarkEmailVerified(h.DB, username, email); err != nil {
+		// A missing record means the account is gone or its email changed after the link was sent
+		apierror.Respond(c, apierror.FromDB(err, errInvalidVerificationLink, "Failed to verify email"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "Email address verified")})
+}
+
+// ResendVerification sends the caller a new verification link. Each email sent makes the caller wait
+// longer before the next one (see auth.LoadVerificationThrottleConfig).
+func (h *UserHandler) ResendVerification(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+
+	var user models.User
+	if err := models.GetUserByID(h.DB, &user, claims.Username); err != nil {
+		log.Printf("Error retrieving user '%s': %v", claims.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to retrieve user"))
+		return
+	}
+	if user.EmailVerified {
+		apierror.Respond(c, apierror.ErrConflict.WithDetail("Email address is already verified"))
+		return
+	}
+	if user.Email == "" {
+		apierror.Respond(c, apierror.BadRequest("No email address on this account"))
+		return
+	}
+
+	if wait := h.VerificationThrottle.AccountRetryAfter(user.Username); wait > 0 {
+		seconds := int(wait.Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		apierror.Respond(c, apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "Please wait before requesting another verification email").
+			With("retry_after", seconds))
+		return
+	}
+
+	if err := h.sendVerificationEmail(&user); err != nil {
+		log.Printf("Error sending verification email to '%s': %v", user.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to send verification email"))
+		return
+	}
+	h.VerificationThrottle.RecordFailure(user.Username, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "Verification email sent")})
+}
+
+// AdminVerifyEmail lets an admin mark a user's current email as verified without the link.
+func (h *UserHandler) AdminVerifyEmail(c *gin.Context) {
+	username := c.Param("username")
+
+	var user models.User
+	if err := models.GetUserByID(h.DB, &user, username); err != nil {
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrUserNotFound, "Failed to retrieve user"))
+		return
+	}
+	if user.Email == "" {
+		apierror.Respond(c, apierror.BadRequest("User has no email address"))
+		return
+	}
+
+	if err := models.MarkEmailVerified(h.DB, user.Username, user.Email); err != nil {
+		log.Printf("Error verifying email of '%s': %v", username, err)
+		apierror.Respond(c, apierror.Internal("Failed to verify email"))
+		return
+	}
+	middleware.LogSecurityEvent(c, "email_verified_by_admin", username)
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "Email address of %s marked as verified", username)})
+}
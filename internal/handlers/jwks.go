@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"net/http"
+	"order-notification-system/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS publishes the public signing keys so other services can verify our tokens.
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, auth.JWKS())
+}
@@ -2,28 +2,42 @@ package handlers
 
 import (
 	"errors"
+	"log"
 	"net/http"
+	"order-notification-system/internal/apierror"
 	"order-notification-system/internal/auth" // Updated import path
+	"order-notification-system/internal/i18n"
+	"order-notification-system/internal/middleware"
 	"order-notification-system/internal/models"
+	"order-notification-system/internal/validation"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username string `json:"username" binding:"required,max=254"`
+	Password string `json:"password" binding:"required,max=1024"`
+}
+
+// RefreshRequest is the body of POST /api/token/refresh.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required,max=256"`
 }
 
 // AuthHandler holds dependencies for authentication handlers.
 type AuthHandler struct {
-	DB *gorm.DB
+	DB       *gorm.DB
+	Tickets  *auth.TicketStore
+	Throttle *auth.LoginThrottle
+	MFA      *auth.MFAChallengeStore
 }
 
 // NewAuthHandler creates a new AuthHandler instance.
-func NewAuthHandler(db *gorm.DB) *AuthHandler {
-	return &AuthHandler{DB: db}
+func NewAuthHandler(db *gorm.DB, tickets *auth.TicketStore, throttle *auth.LoginThrottle, mfa *auth.MFAChallengeStore) *AuthHandler {
+	return &AuthHandler{DB: db, Tickets: tickets, Throttle: throttle, MFA: mfa}
 }
 
 // Login handles user authentication
@@ -31,45 +45,238 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	var loginReq LoginRequest
 	var user models.User
 
-	if err := c.ShouldBindJSON(&loginReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": "Invalid request format",
-		})
+	if !validation.BindJSON(c, &loginReq) {
+		return
+	}
+
+	ip := c.ClientIP()
+	if wait := h.Throttle.RetryAfter(loginReq.Username, ip); wait > 0 {
+		respondTooManyAttempts(c, wait)
+		return
+	}
+	if lockout, err := models.GetActiveAccountLockout(h.DB, loginReq.Username); err == nil {
+		respondTooManyAttempts(c, time.Until(lockout.LockedUntil))
+		return
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Error checking lockout for '%s': %v", loginReq.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to log in"))
+		return
+	}
+
+	// Unknown users and wrong passwords get the same response, and both pay for a bcrypt comparison
+	err := models.GetUserByID(h.DB, &user, loginReq.Username)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Error retrieving user '%s': %v", loginReq.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to log in"))
+		return
+	}
+	if err != nil || !checkPassword(user.Password, loginReq.Password) {
+		h.recordLoginFailure(c, loginReq.Username, ip)
+		apierror.Respond(c, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid username or password"))
+		return
+	}
+	rehashPasswordIfNeeded(h.DB, &user, loginReq.Password)
+	// Only revealed after the password check, so it does not tell strangers the account exists
+	if user.IsSuspended() {
+		respondAccountSuspended(c)
+		return
+	}
+
+	// Enrolled users, and users whose role requires it, must pass a second step
+	secret, err := models.GetTwoFactorSecret(h.DB, user.Username)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Error retrieving two-factor settings of '%s': %v", user.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to log in"))
+		return
+	}
+	enrolled := err == nil && secret.Enabled
+	if enrolled || auth.TwoFactorRequired(user.Role) {
+		h.startMFAChallenge(c, user.Username, !enrolled)
+		return
+	}
+
+	h.finishLogin(c, &user, nil)
+}
+
+// finishLogin starts a session for user and replies with its tokens, plus any extra fields.
+func (h *AuthHandler) finishLogin(c *gin.Context, user *models.User, extra gin.H) {
+	if user.IsSuspended() {
+		respondAccountSuspended(c)
+		return
+	}
+	h.Throttle.RecordSuccess(user.Username)
+
+	refreshToken, sessionID, err := h.issueRefreshToken(user.Username)
+	if err != nil {
+		log.Printf("Error issuing refresh token for '%s': %v", user.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to generate token"))
+		return
+	}
+
+	body, err := tokenResponse(user, refreshToken, sessionID)
+	if err != nil {
+		apierror.Respond(c, apierror.Internal("Failed to generate token"))
+		return
+	}
+	for key, value := range extra {
+		body[key] = value
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// UnlockAccount lets an admin lift an account lockout before it expires.
+func (h *AuthHandler) UnlockAccount(c *gin.Context) {
+	username := c.Param("username")
+	unlockedBy := ""
+	if claims, ok := middleware.GetClaims(c); ok {
+		unlockedBy = claims.Username
+	}
+
+	lifted, err := models.UnlockAccount(h.DB, username, unlockedBy)
+	if err != nil {
+		log.Printf("Error unlocking account '%s': %v", username, err)
+		apierror.Respond(c, apierror.Internal("Failed to unlock account"))
+		return
+	}
+	h.Throttle.Reset(username)
+	middleware.LogSecurityEvent(c, "account_unlocked", username)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "Account %s unlocked", username), "lockouts_lifted": lifted})
+}
+
+// recordLoginFailure counts a failed login and records a lockout when a threshold is reached.
+func (h *AuthHandler) recordLoginFailure(c *gin.Context, username, ip string) {
+	accountLocked, ipLocked := h.Throttle.RecordFailure(username, ip)
+	lockedUntil := time.Now().Add(h.Throttle.LockoutDuration())
+
+	if accountLocked {
+		middleware.LogSecurityEvent(c, "account_locked", username)
+		if err := models.CreateLoginLockout(h.DB, &models.LoginLockout{
+			Username: username, IP: ip, Reason: models.LockoutReasonAccount, LockedUntil: lockedUntil,
+		}); err != nil {
+			log.Printf("Error recording lockout for '%s': %v", username, err)
+		}
+	}
+	if ipLocked {
+		middleware.LogSecurityEvent(c, "ip_locked", ip)
+		if err := models.CreateLoginLockout(h.DB, &models.LoginLockout{
+			IP: ip, Reason: models.LockoutReasonIP, LockedUntil: lockedUntil,
+		}); err != nil {
+			log.Printf("Error recording lockout for IP %s: %v", ip, err)
+		}
+	}
+}
+
+func respondAccountSuspended(c *gin.Context) {
+	apierror.Respond(c, apierror.ErrAccountSuspended)
+}
+
+func respondTooManyAttempts(c *gin.Context, wait time.Duration) {
+	seconds := int(wait.Seconds()) + 1
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	apierror.Respond(c, apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "Too many failed login attempts. Try again later.").
+		With("retry_after", seconds))
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token.
+// Each refresh token works once; presenting a used one revokes every refresh and access token
+// from the same login.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+
+	refreshToken, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		apierror.Respond(c, apierror.Internal("Failed to generate token"))
+		return
+	}
+	next := &models.RefreshToken{TokenHash: hash, ExpiresAt: time.Now().Add(auth.RefreshTokenTTL())}
+
+	if err := models.RotateRefreshToken(h.DB, auth.HashOpaqueToken(req.RefreshToken), next); err != nil {
+		if errors.Is(err, models.ErrRefreshTokenReused) {
+			middleware.LogSecurityEvent(c, "refresh_token_reuse", next.Username)
+			// Whoever holds the stolen token may also hold a live access token of the session
+			if store := auth.Revocations(); store != nil {
+				if err := store.RevokeSession(next.FamilyID); err != nil {
+					log.Printf("Error revoking session of reused refresh token for '%s': %v", next.Username, err)
+				}
+			}
+		}
+		if errors.Is(err, models.ErrRefreshTokenInvalid) || errors.Is(err, models.ErrRefreshTokenReused) {
+			apierror.Respond(c, apierror.ErrInvalidToken.WithDetail("Invalid or expired refresh token"))
+			return
+		}
+		log.Printf("Error rotating refresh token: %v", err)
+		apierror.Respond(c, apierror.Internal("Failed to refresh token"))
 		return
 	}
 
-	if err := models.GetUserByID(h.DB, &user, loginReq.Username); err != nil {
+	// Reload the user so a changed role takes effect at the next refresh
+	var user models.User
+	if err := models.GetUserByID(h.DB, &user, next.Username); err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "User not found"})
+			// The account is gone; do not leave a usable token behind
+			_ = models.RevokeRefreshTokenFamily(h.DB, next.FamilyID)
+			apierror.Respond(c, apierror.ErrInvalidToken.WithDetail("Invalid or expired refresh token"))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error retrieving user: " + err.Error()})
+			log.Printf("Error retrieving user '%s' for refresh: %v", next.Username, err)
+			apierror.Respond(c, apierror.Internal("Failed to refresh token"))
 		}
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword(
-		[]byte(user.Password),
-		[]byte(loginReq.Password),
-	); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"status":  "error",
-			"message": "Invalid password",
-		})
+	if user.IsSuspended() {
+		_ = models.RevokeRefreshTokenFamily(h.DB, next.FamilyID)
+		respondAccountSuspended(c)
 		return
 	}
 
-	token, err := auth.GenerateToken(user.Username)
+	respondWithTokens(c, &user, refreshToken, next.FamilyID)
+}
+
+// issueRefreshToken stores a refresh token starting a new token family.
+// It returns the raw token and the family ID, which identifies the session.
+func (h *AuthHandler) issueRefreshToken(username string) (string, string, error) {
+	familyID, err := auth.NewTokenID()
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	err = models.CreateRefreshToken(h.DB, &models.RefreshToken{
+		Username:  username,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(auth.RefreshTokenTTL()),
+	})
+	return refreshToken, familyID, err
+}
+
+// respondWithTokens issues an access token for user and replies with it and the refresh token.
+func respondWithTokens(c *gin.Context, user *models.User, refreshToken string, sessionID string) {
+	body, err := tokenResponse(user, refreshToken, sessionID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"message": "Failed to generate token",
-		})
+		apierror.Respond(c, apierror.Internal("Failed to generate token"))
 		return
 	}
+	c.JSON(http.StatusOK, body)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"status": "success",
-		"token":  token,
-	})
+// tokenResponse issues an access token for user and builds the token response body.
+func tokenResponse(user *models.User, refreshToken string, sessionID string) (gin.H, error) {
+	token, err := auth.GenerateToken(user.Username, user.Role, sessionID, user.Language)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"status":        "success",
+		"token":         token,
+		"token_type":    "Bearer",
+		"expires_in":    int(auth.AccessTokenTTL().Seconds()),
+		"refresh_token": refreshToken,
+	}, nil
 }
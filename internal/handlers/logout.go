@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/auth"
+	"order-notification-system/internal/i18n"
+	"order-notification-system/internal/middleware"
+	"order-notification-system/internal/models"
+	"order-notification-system/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Logout ends the current session: the access token is revoked and the refresh tokens of its login stop working.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+	if claims.IsAPIKey() {
+		apierror.Respond(c, apierror.ErrNotForAPIKeys.WithDetail("API keys have no session; revoke the key instead"))
+		return
+	}
+
+	if err := auth.Revocations().RevokeToken(claims); err != nil {
+		log.Printf("Error revoking token for '%s': %v", claims.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to log out"))
+		return
+	}
+	if claims.SessionID != "" {
+		if err := models.RevokeRefreshTokenFamily(h.DB, claims.SessionID); err != nil {
+			log.Printf("Error revoking refresh tokens for '%s': %v", claims.Username, err)
+			apierror.Respond(c, apierror.Internal("Failed to log out"))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "Logged out")})
+}
+
+// LogoutAll ends every session of the caller.
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+	if claims.IsAPIKey() {
+		apierror.Respond(c, apierror.ErrNotForAPIKeys.WithDetail("API keys have no session; revoke the key instead"))
+		return
+	}
+
+	if err := revokeAllSessions(claims.Username); err != nil {
+		log.Printf("Error revoking sessions for '%s': %v", claims.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to log out"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "Logged out of all sessions")})
+}
+
+// RevokeUserSessions lets an admin end every session of the user in the path.
+func (h *AuthHandler) RevokeUserSessions(c *gin.Context) {
+	username := c.Param("username")
+
+	var user models.User
+	if err := models.GetUserByID(h.DB, &user, username); err != nil {
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrUserNotFound, "Failed to retrieve user"))
+		return
+	}
+
+	if err := revokeAllSessions(username); err != nil {
+		log.Printf("Error revoking sessions for '%s': %v", username, err)
+		apierror.Respond(c, apierror.Internal("Failed to revoke sessions"))
+		return
+	}
+	middleware.LogSecurityEvent(c, "sessions_revoked", username)
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "All sessions of %s have been revoked", username)})
+}
+
+// revokeAllSessions invalidates every access and refresh token of username and drops their WebSocket connections.
+func revokeAllSessions(username string) error {
+	if err := auth.Revocations().RevokeUser(username); err != nil {
+		return err
+	}
+	utils.DisconnectUser(username)
+	return nil
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/i18n"
+	"order-notification-system/internal/middleware"
+	"order-notification-system/internal/models"
+	"order-notification-system/internal/utils"
+	"order-notification-system/internal/validation"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// NotificationHandler holds dependencies for the notification inbox handlers.
+type NotificationHandler struct {
+	DB *gorm.DB
+}
+
+// NewNotificationHandler creates a new NotificationHandler instance.
+func NewNotificationHandler(db *gorm.DB) *NotificationHandler {
+	return &NotificationHandler{DB: db}
+}
+
+// BulkReadRequest marks several notifications at once. An empty IDs list means all notifications.
+type BulkReadRequest struct {
+	IDs  []uint `json:"ids" binding:"max=1000,dive,gt=0"`
+	Read *bool  `json:"read" binding:"required"`
+}
+
+// ListNotifications returns the caller's notifications, newest first.
+// Query: ?unread=true, ?limit= (default 20, max 100), ?offset=
+func (h *NotificationHandler) ListNotifications(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+
+	limit, offset := parsePagination(c)
+	unreadOnly := c.Query("unread") == "true"
+
+	notifications, total, err := models.ListNotifications(h.DB, claims.Username, unreadOnly, limit, offset)
+	if err != nil {
+		log.Printf("Error listing notifications for '%s': %v", claims.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to retrieve notifications"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   notifications,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// GetUnreadCount returns how many unread notifications the caller has.
+func (h *NotificationHandler) GetUnreadCount(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+
+	count, err := models.CountUnreadNotifications(h.DB, claims.Username)
+	if err != nil {
+		log.Printf("Error counting notifications for '%s': %v", claims.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to count notifications"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "count": count})
+}
+
+// MarkRead marks one notification as read.
+func (h *NotificationHandler) MarkRead(c *gin.Context) {
+	h.setRead(c, true)
+}
+
+// MarkUnread marks one notification as unread.
+func (h *NotificationHandler) MarkUnread(c *gin.Context) {
+	h.setRead(c, false)
+}
+
+func (h *NotificationHandler) setRead(c *gin.Context, read bool) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("Notification id must be a positive integer"))
+		return
+	}
+
+	if err := models.SetNotificationRead(h.DB, claims.Username, uint(id), read); err != nil {
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrNotificationNotFound, "Failed to update notification"))
+		return
+	}
+
+	utils.PushUnreadCount(h.DB, claims.Username)
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "Notification updated")})
+}
+
+// BulkMarkRead marks the listed notifications (or all of them) read or unread.
+func (h *NotificationHandler) BulkMarkRead(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+
+	var req BulkReadRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+
+	updated, err := models.SetNotificationsRead(h.DB, claims.Username, req.IDs, *req.Read)
+	if err != nil {
+		log.Printf("Error bulk-updating notifications for '%s': %v", claims.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to update notifications"))
+		return
+	}
+
+	utils.PushUnreadCount(h.DB, claims.Username)
+	c.JSON(http.StatusOK, gin.H{"status": "success", "updated": updated})
+}
+
+// parsePagination reads ?limit= and ?offset= with sane defaults and bounds.
+func parsePagination(c *gin.Context) (int, int) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/auth"
+	"order-notification-system/internal/config"
+	"order-notification-system/internal/i18n"
+	"order-notification-system/internal/mail"
+	"order-notification-system/internal/middleware"
+	"order-notification-system/internal/models"
+	"order-notification-system/internal/validation"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// checkPassword compares password with a bcrypt hash. An empty hash (unknown user)
+// is compared against a dummy hash of the same cost, so both cases take as long
+// and the response time does not reveal whether the user exists.
+func checkPassword(hash, password string) bool {
+	if hash == "" {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), auth.PasswordHashCost())
+		})
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// validatePassword enforces the password policy for the account identified by username and email.
+func validatePassword(password, username, email string) error {
+	return auth.LoadPasswordPolicy().Validate(password, username, email)
+}
+
+// respondPasswordPolicy reports a password policy violation as a validation error on field.
+func respondPasswordPolicy(c *gin.Context, field string, err error) {
+	var policyErr *auth.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		validation.RespondField(c, field, "policy", policyErr.Message, policyErr.Args...)
+		return
+	}
+	validation.RespondField(c, field, "policy", err.Error())
+}
+
+// rehashPasswordIfNeeded stores a new hash of password, which has just been verified against
+// user.Password, when that hash was made with a different cost than BCRYPT_COST.
+func rehashPasswordIfNeeded(db *gorm.DB, user *models.User, password string) {
+	if !auth.PasswordNeedsRehash(user.Password) {
+		return
+	}
+	hash, err := auth.HashPassword(password)
+	if err == nil {
+		err = models.UpdateUserPassword(db, user.Username, hash)
+	}
+	if err != nil {
+		log.Printf("Error rehashing password of '%s': %v", user.Username, err)
+		return
+	}
+	user.Password = hash
+}
+
+// PasswordHandler holds dependencies for the password change and reset handlers.
+type PasswordHandler struct {
+	DB       *gorm.DB
+	Mailer   mail.Sender
+	Throttle *auth.LoginThrottle
+	// ResetThrottle limits reset requests per IP and reset emails per requested account
+	ResetThrottle *auth.LoginThrottle
+
+	// resetQueue feeds the worker that looks accounts up and sends reset emails
+	resetQueue chan resetRequest
+}
+
+// resetRequest is a queued password reset for the account named by Username or Email.
+type resetRequest struct {
+	Username string
+	Email    string
+}
+
+// NewPasswordHandler creates a new PasswordHandler instance and starts its reset email worker.
+// Up to PASSWORD_RESET_QUEUE_SIZE (default 100) reset requests wait for the worker; more are dropped.
+func NewPasswordHandler(db *gorm.DB, mailer mail.Sender, throttle, resetThrottle *auth.LoginThrottle) *PasswordHandler {
+	h := &PasswordHandler{
+		DB:            db,
+		Mailer:        mailer,
+		Throttle:      throttle,
+		ResetThrottle: resetThrottle,
+		resetQueue:    make(chan resetRequest, config.GetEnvInt("PASSWORD_RESET_QUEUE_SIZE", 100)),
+	}
+	go func() {
+		for request := range h.resetQueue {
+			h.sendResetLink(request.Username, request.Email)
+		}
+	}()
+	return h
+}
+
+// ChangePasswordRequest is the body of PUT /api/users/:username/password.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required,max=1024"`
+	NewPassword     string `json:"new_password" binding:"required,max=1024"`
+}
+
+// ForgotPasswordRequest identifies the account by username or email.
+type ForgotPasswordRequest struct {
+	Username string `json:"username" binding:"required_without=Email,max=50"`
+	Email    string `json:"email" binding:"omitempty,email,max=254"`
+}
+
+// ResetPasswordRequest is the body of POST /api/password/reset.
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required,max=256"`
+	NewPassword string `json:"new_password" binding:"required,max=1024"`
+}
+
+// forgotPasswordResponse is returned whether or not the account exists, so it cannot be used to find accounts.
+func forgotPasswordResponse(c *gin.Context) gin.H {
+	return gin.H{
+		"status":  "success",
+		"message": i18n.T(c, "If the account exists, a password reset link has been sent to its email address"),
+	}
+}
+
+// ForgotPassword emails a single-use reset link valid for PASSWORD_RESET_TTL (default 30m).
+// Requests are limited per IP. Emails are limited per requested account, but a request for an
+// account that has had too many emails is still accepted, so nobody can block another user's
+// resets. The account is looked up and the email sent by a background worker, so the response
+// takes as long whether or not the account exists.
+func (h *PasswordHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+
+	// Throttle by what was asked for, not by what was found, so limits look the same for unknown accounts
+	key := "username:" + req.Username
+	if req.Username == "" {
+		key = "email:" + strings.ToLower(strings.TrimSpace(req.Email))
+	}
+	ip := c.ClientIP()
+	if wait := h.ResetThrottle.IPRetryAfter(ip); wait > 0 {
+		seconds := int(wait.Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		apierror.Respond(c, apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "Too many password reset requests. Try again later.").
+			With("retry_after", seconds))
+		return
+	}
+	if h.ResetThrottle.AccountRetryAfter(key) > 0 {
+		// The account has had enough emails for now; answer as usual without sending another
+		h.ResetThrottle.RecordIPFailure(ip)
+		c.JSON(http.StatusAccepted, forgotPasswordResponse(c))
+		return
+	}
+	h.ResetThrottle.RecordFailure(key, ip)
+
+	select {
+	case h.resetQueue <- resetRequest{Username: req.Username, Email: req.Email}:
+	default:
+		log.Printf("Password reset queue is full; dropped a request from %s", ip)
+	}
+	c.JSON(http.StatusAccepted, forgotPasswordResponse(c))
+}
+
+// sendResetLink creates a reset token for the account named by username, or for every account
+// with email, and emails the links. Email addresses are not unique, so each account sharing one
+// gets its own link naming it. It runs after the response is sent, so failures are only logged.
+func (h *PasswordHandler) sendResetLink(username, email string) {
+	var users []models.User
+	var err error
+	if username != "" {
+		var user models.User
+		err = models.GetUserByID(h.DB, &user, username)
+		users = []models.User{user}
+	} else {
+		users, err = models.GetUsersByEmail(h.DB, email)
+	}
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error looking up account for password reset: %v", err)
+		}
+		return
+	}
+	for i := range users {
+		h.sendResetLinkTo(&users[i])
+	}
+}
+
+// sendResetLinkTo creates a reset token for user and emails them the link.
+func (h *PasswordHandler) sendResetLinkTo(user *models.User) {
+	if user.Email == "" {
+		log.Printf("Password reset requested for '%s', who has no email address", user.Username)
+		return
+	}
+
+	rawToken, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		log.Printf("Error creating password reset token for '%s': %v", user.Username, err)
+		return
+	}
+	ttl := config.GetEnvDuration("PASSWORD_RESET_TTL", 30*time.Minute)
+	if err := models.CreatePasswordResetToken(h.DB, &models.PasswordResetToken{
+		Username:  user.Username,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+	}); err != nil {
+		log.Printf("Error storing password reset token for '%s': %v", user.Username, err)
+		return
+	}
+
+	link := config.GetEnv("PASSWORD_RESET_URL", "http://localhost:8080/reset-password") + "?token=" + rawToken
+	err = h.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nUse the link below to choose a new password. It expires in %v and can be used once.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.Username, ttl, link),
+	})
+	if err != nil {
+		log.Printf("Error sending password reset email to '%s': %v", user.Username, err)
+	}
+}
+
+// ResetPassword sets a new password using a reset token and ends every existing session of the account.
+func (h *PasswordHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+
+	var username string
+	err := models.ConsumePasswordResetToken(h.DB, auth.HashOpaqueToken(req.Token), func(tx *gorm.DB, tokenUser string) error {
+		username = tokenUser
+		var user models.User
+		if err := models.GetUserByID(tx, &user, tokenUser); err != nil {
+			return err
+		}
+		if err := validatePassword(req.NewPassword, user.Username, user.Email); err != nil {
+			return err
+		}
+		hashedPassword, err := auth.HashPassword(req.NewPassword)
+		if err != nil {
+			return err
+		}
+		return models.UpdateUserPassword(tx, tokenUser, hashedPassword)
+	})
+	if err != nil {
+		var policyErr *auth.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			// The transaction rolled back, so the token can be used again with a better password
+			respondPasswordPolicy(c, "new_password", policyErr)
+		} else if errors.Is(err, models.ErrResetTokenInvalid) || errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidToken, "Invalid or expired reset token"))
+		} else {
+			log.Printf("Error resetting password: %v", err)
+			apierror.Respond(c, apierror.Internal("Failed to reset password"))
+		}
+		return
+	}
+
+	if err := revokeAllSessions(username); err != nil {
+		log.Printf("Error revoking sessions of '%s' after password reset: %v", username, err)
+	}
+	middleware.LogSecurityEvent(c, "password_reset", username)
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "Password has been reset. Please log in again.")})
+}
+
+// ChangePassword lets a user replace their own password, given the current one.
+// Every session of the account ends, including the caller's.
+func (h *PasswordHandler) ChangePassword(c *gin.Context) {
+	username := c.Param("username")
+	claims, ok := middleware.GetClaims(c)
+	if !ok || claims.IsAPIKey() || claims.Username != username {
+		// selfOrAdmin lets users:manage through; even they cannot change another user's password
+		middleware.LogSecurityEvent(c, "access_denied", username)
+		apierror.Respond(c, apierror.ErrForbidden.WithDetail("You can only change your own password"))
+		return
+	}
+
+	var req ChangePasswordRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+
+	ip := c.ClientIP()
+	if wait := h.Throttle.RetryAfter(username, ip); wait > 0 {
+		respondTooManyAttempts(c, wait)
+		return
+	}
+
+	var user models.User
+	if err := models.GetUserByID(h.DB, &user, username); err != nil {
+		log.Printf("Error retrieving user '%s': %v", username, err)
+		apierror.Respond(c, apierror.Internal("Failed to change password"))
+		return
+	}
+	if !checkPassword(user.Password, req.CurrentPassword) {
+		h.Throttle.RecordFailure(username, ip)
+		middleware.LogSecurityEvent(c, "password_change_failed", username)
+		apierror.Respond(c, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Current password is incorrect"))
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		validation.RespondField(c, "new_password", "different", "must be different from the current password")
+		return
+	}
+	if err := validatePassword(req.NewPassword, user.Username, user.Email); err != nil {
+		respondPasswordPolicy(c, "new_password", err)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(req.NewPassword)
+	if err == nil {
+		err = models.UpdateUserPassword(h.DB, username, hashedPassword)
+	}
+	if err != nil {
+		log.Printf("Error changing password of '%s': %v", username, err)
+		apierror.Respond(c, apierror.Internal("Failed to change password"))
+		return
+	}
+	h.Throttle.RecordSuccess(username)
+
+	if err := revokeAllSessions(username); err != nil {
+		log.Printf("Error revoking sessions of '%s' after password change: %v", username, err)
+	}
+	middleware.LogSecurityEvent(c, "password_changed", username)
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "Password changed. Please log in again.")})
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/auth"
+	"order-notification-system/internal/i18n"
+	"order-notification-system/internal/middleware"
+	"order-notification-system/internal/models"
+	"order-notification-system/internal/validation"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PrivacyHandler serves data subject requests under the PDPA: exporting and erasing a user's data.
+// Users make them for themselves; callers with users:manage can make them on a user's behalf.
+// Every request is recorded in the privacy_requests table.
+type PrivacyHandler struct {
+	DB       *gorm.DB
+	Throttle *auth.LoginThrottle
+}
+
+// NewPrivacyHandler creates a new PrivacyHandler instance.
+func NewPrivacyHandler(db *gorm.DB, throttle *auth.LoginThrottle) *PrivacyHandler {
+	return &PrivacyHandler{DB: db, Throttle: throttle}
+}
+
+// Export formats.
+const (
+	exportFormatJSON = "json"
+	exportFormatZIP  = "zip"
+)
+
+// UserExport is the bundle returned by an export.
+type UserExport struct {
+	ExportedAt    time.Time             `json:"exported_at"`
+	Profile       AdminUserView         `json:"profile"`
+	Orders        []models.Order        `json:"orders"`
+	Notifications []models.Notification `json:"notifications"`
+}
+
+// ExportUserData returns everything stored about the user in the path: profile, orders and notifications.
+// Query: ?format=json (default, one document) or ?format=zip (profile.json, orders.json and notifications.json).
+func (h *PrivacyHandler) ExportUserData(c *gin.Context) {
+	username := c.Param("username")
+	format := strings.ToLower(c.DefaultQuery("format", exportFormatJSON))
+	if format != exportFormatJSON && format != exportFormatZIP {
+		validation.RespondField(c, "format", "oneof", "must be one of: %s", "json, zip")
+		return
+	}
+
+	data, err := models.GetUserData(h.DB, username)
+	if err != nil {
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrUserNotFound, "Failed to export user data"))
+		return
+	}
+	if data.User.IsErased() {
+		apierror.Respond(c, apierror.ErrUserErased)
+		return
+	}
+	export := UserExport{
+		ExportedAt:    time.Now().UTC(),
+		Profile:       NewAdminUserView(&data.User),
+		Orders:        data.Orders,
+		Notifications: data.Notifications,
+	}
+
+	// The export is only handed out once it has been recorded
+	request := newPrivacyRequest(c, models.PrivacyRequestExport, username)
+	request.Format = format
+	if err := models.CreatePrivacyRequest(h.DB, request); err != nil {
+		apierror.Respond(c, apierror.Internal("Failed to export user data").Wrap(err))
+		return
+	}
+	middleware.LogSecurityEvent(c, "data_exported", username)
+
+	filename := username + "-data-" + export.ExportedAt.Format("20060102")
+	c.Header("Cache-Control", "no-store")
+	if format == exportFormatZIP {
+		body, err := exportArchive(&export)
+		if err != nil {
+			apierror.Respond(c, apierror.Internal("Failed to export user data").Wrap(err))
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+		c.Data(http.StatusOK, "application/zip", body)
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+	c.JSON(http.StatusOK, export)
+}
+
+// exportArchive packs an export as a ZIP with one JSON file per part.
+func exportArchive(export *UserExport) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", gin.H{"exported_at": export.ExportedAt, "profile": export.Profile}},
+		{"orders.json", export.Orders},
+		{"notifications.json", export.Notifications},
+	}
+	for _, file := range files {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: export.ExportedAt})
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EraseUserRequest is the body of POST /api/users/:username/erase. Users confirm their own
+// erasure with their password; administrators acting for a user give the reason instead.
+type EraseUserRequest struct {
+	Password string `json:"password" binding:"max=1024"`
+	Reason   string `json:"reason" binding:"max=255"`
+}
+
+// EraseUser anonymizes the user in the path. The account is renamed to a pseudonym, its personal
+// fields and password are cleared and its sessions end; its orders are kept for accounting
+// under the pseudonym. Erasure cannot be undone.
+func (h *PrivacyHandler) EraseUser(c *gin.Context) {
+	username := c.Param("username")
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+
+	var req EraseUserRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+
+	var user models.User
+	if err := models.GetUserByID(h.DB, &user, username); err != nil {
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrUserNotFound, "Failed to retrieve user"))
+		return
+	}
+	if user.IsErased() {
+		apierror.Respond(c, apierror.ErrUserErased)
+		return
+	}
+
+	if !claims.IsAPIKey() && claims.Username == username {
+		if req.Password == "" {
+			validation.RespondField(c, "password", "required", "is required")
+			return
+		}
+		ip := c.ClientIP()
+		if wait := h.Throttle.RetryAfter(username, ip); wait > 0 {
+			respondTooManyAttempts(c, wait)
+			return
+		}
+		if !checkPassword(user.Password, req.Password) {
+			h.Throttle.RecordFailure(username, ip)
+			middleware.LogSecurityEvent(c, "erasure_failed", username)
+			apierror.Respond(c, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Current password is incorrect"))
+			return
+		}
+		h.Throttle.RecordSuccess(username)
+	} else if reason == "" {
+		validation.RespondField(c, "reason", "required", "is required")
+		return
+	}
+
+	id, err := auth.NewTokenID()
+	if err != nil {
+		apierror.Respond(c, apierror.Internal("Failed to erase user").Wrap(err))
+		return
+	}
+	pseudonym := "erased-" + id[:12]
+	// Sessions are found through the refresh tokens, which erasure deletes, so revoke them first
+	if err := revokeAllSessions(username); err != nil {
+		apierror.Respond(c, apierror.Internal("Failed to erase user").Wrap(err))
+		return
+	}
+	request := newPrivacyRequest(c, models.PrivacyRequestErasure, username)
+	request.Reason = reason
+	if err := models.EraseUser(h.DB, username, pseudonym, request); err != nil {
+		if errors.Is(err, models.ErrUserErased) {
+			apierror.Respond(c, apierror.ErrUserErased)
+			return
+		}
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrUserNotFound, "Failed to erase user"))
+		return
+	}
+
+	if store := auth.Revocations(); store != nil {
+		store.SetSuspended(username, false)
+	}
+	middleware.LogSecurityEvent(c, "user_erased", pseudonym)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": i18n.T(c, "Account erased; its orders are kept under %s", pseudonym),
+		"data":    gin.H{"username": pseudonym},
+	})
+}
+
+// newPrivacyRequest starts the audit record of a request about subject made by the caller.
+func newPrivacyRequest(c *gin.Context, requestType, subject string) *models.PrivacyRequest {
+	request := &models.PrivacyRequest{Type: requestType, Subject: subject, IP: c.ClientIP()}
+	if claims, ok := middleware.GetClaims(c); ok {
+		request.RequestedBy = claims.Username
+		request.OnBehalf = claims.IsAPIKey() || claims.Username != subject
+	}
+	return request
+}
+
+// ListPrivacyRequests returns the recorded exports and erasures, newest first.
+// Query: ?username= (only requests about that account), ?limit= (default 20, max 100), ?offset=
+func (h *PrivacyHandler) ListPrivacyRequests(c *gin.Context) {
+	limit, offset := parsePagination(c)
+	requests, total, err := models.ListPrivacyRequests(h.DB, c.Query("username"), limit, offset)
+	if err != nil {
+		apierror.Respond(c, apierror.FromDB(err, nil, "Failed to retrieve privacy requests"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   requests,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
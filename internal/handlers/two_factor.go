@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/auth"
+	"order-notification-system/internal/i18n"
+	"order-notification-system/internal/middleware"
+	"order-notification-system/internal/models"
+	"order-notification-system/internal/validation"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errSecondFactorInvalid means a TOTP or recovery code was wrong, reused or missing.
+var errSecondFactorInvalid = errors.New("invalid two-factor code")
+
+// MFALoginRequest is the body of the second login step.
+// Exactly one of Code (from the authenticator app) and RecoveryCode is expected.
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required,max=128"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode,max=20"`
+	RecoveryCode string `json:"recovery_code" binding:"max=32"`
+}
+
+// MFAEnrollRequest starts TOTP enrolment during a login that requires it.
+type MFAEnrollRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required,max=128"`
+}
+
+// MFAConfirmRequest confirms the enrolment started during login with the first code from the app.
+type MFAConfirmRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required,max=128"`
+	Code     string `json:"code" binding:"required,max=20"`
+}
+
+// TwoFactorCodeRequest carries a TOTP code from the authenticator app.
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required,max=20"`
+}
+
+// DisableTwoFactorRequest is the body of DELETE /api/2fa.
+type DisableTwoFactorRequest struct {
+	Password     string `json:"password" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode,max=20"`
+	RecoveryCode string `json:"recovery_code" binding:"max=32"`
+}
+
+// startMFAChallenge replies to a correct password with a challenge token instead of access tokens.
+func (h *AuthHandler) startMFAChallenge(c *gin.Context, username string, enroll bool) {
+	token, expiresAt, err := h.MFA.Issue(username, enroll)
+	if err != nil {
+		log.Printf("Error issuing login challenge for '%s': %v", username, err)
+		apierror.Respond(c, apierror.Internal("Failed to log in"))
+		return
+	}
+
+	status, message := "2fa_required", "Enter the code from your authenticator app or a recovery code"
+	if enroll {
+		status, message = "2fa_enrollment_required", "Your role requires two-factor authentication; enrol an authenticator app to continue"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     status,
+		"message":    i18n.T(c, message),
+		"mfa_token":  token,
+		"expires_in": int(time.Until(expiresAt).Seconds()),
+	})
+}
+
+// LoginWithSecondFactor completes a login with a TOTP code or a recovery code.
+func (h *AuthHandler) LoginWithSecondFactor(c *gin.Context) {
+	var req MFALoginRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+
+	challenge, ok := h.loginChallenge(c, req.MFAToken, false)
+	if !ok {
+		return
+	}
+
+	err := h.verifySecondFactor(challenge.Username, req.Code, req.RecoveryCode)
+	if errors.Is(err, errSecondFactorInvalid) {
+		h.failLoginChallenge(c, req.MFAToken, challenge.Username)
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying second factor of '%s': %v", challenge.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to log in"))
+		return
+	}
+	if req.Code == "" {
+		middleware.LogSecurityEvent(c, "recovery_code_used", challenge.Username)
+	}
+
+	h.completeLoginChallenge(c, req.MFAToken, challenge.Username, nil)
+}
+
+// StartLoginEnrollment returns a new TOTP secret to a user who must enrol before their login can finish.
+func (h *AuthHandler) StartLoginEnrollment(c *gin.Context) {
+	var req MFAEnrollRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+
+	challenge, ok := h.loginChallenge(c, req.MFAToken, true)
+	if !ok {
+		return
+	}
+	h.startEnrollment(c, challenge.Username)
+}
+
+// ConfirmLoginEnrollment enables the TOTP secret from StartLoginEnrollment and finishes the login.
+// The response carries the recovery codes alongside the tokens.
+func (h *AuthHandler) ConfirmLoginEnrollment(c *gin.Context) {
+	var req MFAConfirmRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+
+	challenge, ok := h.loginChallenge(c, req.MFAToken, true)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := h.confirmEnrollment(challenge.Username, req.Code)
+	if errors.Is(err, errSecondFactorInvalid) {
+		h.failLoginChallenge(c, req.MFAToken, challenge.Username)
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Respond(c, apierror.ErrConflict.WithDetail("No enrolment in progress"))
+		return
+	}
+	if err != nil {
+		log.Printf("Error enabling two-factor authentication for '%s': %v", challenge.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to enable two-factor authentication"))
+		return
+	}
+	middleware.LogSecurityEvent(c, "2fa_enabled", challenge.Username)
+
+	h.completeLoginChallenge(c, req.MFAToken, challenge.Username, gin.H{"recovery_codes": recoveryCodes})
+}
+
+// loginChallenge looks up a login challenge and checks it is in the expected step.
+// It writes the error response and returns false otherwise.
+func (h *AuthHandler) loginChallenge(c *gin.Context, token string, enroll bool) (auth.MFAChallenge, bool) {
+	challenge, ok := h.MFA.Get(token)
+	if !ok {
+		apierror.Respond(c, apierror.ErrInvalidToken.WithDetail("Invalid or expired login challenge"))
+		return challenge, false
+	}
+	if challenge.Enroll != enroll {
+		message := "Two-factor enrolment must be completed to log in"
+		if !enroll {
+			message = "Two-factor authentication is already enabled for this account"
+		}
+		apierror.Respond(c, apierror.ErrConflict.WithDetail(message))
+		return challenge, false
+	}
+	if wait := h.Throttle.RetryAfter(challenge.Username, c.ClientIP()); wait > 0 {
+		respondTooManyAttempts(c, wait)
+		return challenge, false
+	}
+	return challenge, true
+}
+
+// failLoginChallenge counts a wrong code against both the challenge and the login throttle.
+func (h *AuthHandler) failLoginChallenge(c *gin.Context, token, username string) {
+	h.MFA.Fail(token)
+	h.recordLoginFailure(c, username, c.ClientIP())
+	apierror.Respond(c, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidSecondFactor, "Invalid two-factor code"))
+}
+
+// completeLoginChallenge consumes the challenge and issues the session tokens.
+func (h *AuthHandler) completeLoginChallenge(c *gin.Context, token, username string, extra gin.H) {
+	if !h.MFA.Complete(token) {
+		apierror.Respond(c, apierror.ErrInvalidToken.WithDetail("Invalid or expired login challenge"))
+		return
+	}
+
+	var user models.User
+	if err := models.GetUserByID(h.DB, &user, username); err != nil {
+		log.Printf("Error retrieving user '%s': %v", username, err)
+		apierror.Respond(c, apierror.Internal("Failed to log in"))
+		return
+	}
+	h.finishLogin(c, &user, extra)
+}
+
+// verifySecondFactor checks a TOTP code, or a recovery code when code is empty, for an enrolled user.
+// Accepted codes are spent. It returns errSecondFactorInvalid for a wrong, reused or missing code.
+func (h *AuthHandler) verifySecondFactor(username, code, recoveryCode string) error {
+	if code == "" {
+		if recoveryCode == "" {
+			return errSecondFactorInvalid
+		}
+		err := models.ConsumeRecoveryCode(h.DB, username, auth.HashRecoveryCode(recoveryCode))
+		if errors.Is(err, models.ErrRecoveryCodeInvalid) {
+			return errSecondFactorInvalid
+		}
+		return err
+	}
+
+	secret, err := models.GetTwoFactorSecret(h.DB, username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errSecondFactorInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if !secret.Enabled {
+		return errSecondFactorInvalid
+	}
+	step, ok := auth.VerifyTOTP(secret.Secret, code, time.Now())
+	if !ok {
+		return errSecondFactorInvalid
+	}
+	err = models.RecordTOTPStep(h.DB, username, step)
+	if errors.Is(err, models.ErrTOTPCodeReused) {
+		return errSecondFactorInvalid
+	}
+	return err
+}
+
+// startEnrollment stores a new pending TOTP secret for username and replies with it.
+func (h *AuthHandler) startEnrollment(c *gin.Context, username string) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret for '%s': %v", username, err)
+		apierror.Respond(c, apierror.Internal("Failed to start enrolment"))
+		return
+	}
+	if err := models.SavePendingTwoFactorSecret(h.DB, username, secret); err != nil {
+		if errors.Is(err, models.ErrTwoFactorEnabled) {
+			apierror.Respond(c, apierror.ErrConflict.WithDetail("Two-factor authentication is already enabled"))
+		} else {
+			log.Printf("Error saving TOTP secret for '%s': %v", username, err)
+			apierror.Respond(c, apierror.Internal("Failed to start enrolment"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "success",
+		"message":     i18n.T(c, "Add the secret to your authenticator app, then confirm with a code from it"),
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPProvisioningURI(username, secret),
+	})
+}
+
+// confirmEnrollment enables the pending secret of username if code matches it and returns new recovery codes.
+// It returns gorm.ErrRecordNotFound when there is no pending enrolment.
+func (h *AuthHandler) confirmEnrollment(username, code string) ([]string, error) {
+	secret, err := models.GetTwoFactorSecret(h.DB, username)
+	if err != nil {
+		return nil, err
+	}
+	if secret.Enabled {
+		return nil, gorm.ErrRecordNotFound
+	}
+	step, ok := auth.VerifyTOTP(secret.Secret, code, time.Now())
+	if !ok {
+		return nil, errSecondFactorInvalid
+	}
+
+	recoveryCodes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := models.EnableTwoFactor(h.DB, username, step, hashes); err != nil {
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
+
+// GetTwoFactorStatus reports whether the caller has two-factor authentication enabled.
+func (h *AuthHandler) GetTwoFactorStatus(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+
+	enabled := false
+	secret, err := models.GetTwoFactorSecret(h.DB, claims.Username)
+	if err == nil {
+		enabled = secret.Enabled
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Error retrieving two-factor settings of '%s': %v", claims.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to retrieve two-factor status"))
+		return
+	}
+
+	remaining, err := models.CountUnusedRecoveryCodes(h.DB, claims.Username)
+	if err != nil {
+		log.Printf("Error counting recovery codes of '%s': %v", claims.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to retrieve two-factor status"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"enabled":                  enabled,
+			"required":                 auth.TwoFactorRequired(claims.Role),
+			"recovery_codes_remaining": remaining,
+		},
+	})
+}
+
+// StartTwoFactorEnrollment returns a new TOTP secret for the caller to add to an authenticator app.
+func (h *AuthHandler) StartTwoFactorEnrollment(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+	h.startEnrollment(c, claims.Username)
+}
+
+// ConfirmTwoFactorEnrollment enables the caller's pending secret and returns their recovery codes.
+func (h *AuthHandler) ConfirmTwoFactorEnrollment(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+	var req TwoFactorCodeRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+
+	recoveryCodes, err := h.confirmEnrollment(claims.Username, req.Code)
+	if errors.Is(err, errSecondFactorInvalid) {
+		apierror.Respond(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidSecondFactor, "Invalid two-factor code"))
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Respond(c, apierror.ErrConflict.WithDetail("No enrolment in progress"))
+		return
+	}
+	if err != nil {
+		log.Printf("Error enabling two-factor authentication for '%s': %v", claims.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to enable two-factor authentication"))
+		return
+	}
+	middleware.LogSecurityEvent(c, "2fa_enabled", claims.Username)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":         "success",
+		"message":        i18n.T(c, "Two-factor authentication enabled. Store these recovery codes somewhere safe; each works once."),
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes after checking a current TOTP code.
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+	var req TwoFactorCodeRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+
+	if err := h.verifySecondFactor(claims.Username, req.Code, ""); err != nil {
+		if errors.Is(err, errSecondFactorInvalid) {
+			apierror.Respond(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidSecondFactor, "Invalid two-factor code"))
+		} else {
+			log.Printf("Error verifying second factor of '%s': %v", claims.Username, err)
+			apierror.Respond(c, apierror.Internal("Failed to regenerate recovery codes"))
+		}
+		return
+	}
+
+	recoveryCodes, hashes, err := auth.GenerateRecoveryCodes()
+	if err == nil {
+		err = models.ReplaceRecoveryCodes(h.DB, claims.Username, hashes)
+	}
+	if err != nil {
+		log.Printf("Error regenerating recovery codes of '%s': %v", claims.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to regenerate recovery codes"))
+		return
+	}
+	middleware.LogSecurityEvent(c, "recovery_codes_regenerated", claims.Username)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "recovery_codes": recoveryCodes})
+}
+
+// DisableTwoFactor turns off the caller's second factor. It needs the password and a
+// current code, and is refused when the caller's role requires two-factor authentication.
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+	var req DisableTwoFactorRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+	if auth.TwoFactorRequired(claims.Role) {
+		apierror.Respond(c, apierror.New(http.StatusForbidden, apierror.CodeTwoFactorRequired, "Two-factor authentication is required for your role"))
+		return
+	}
+
+	var user models.User
+	if err := models.GetUserByID(h.DB, &user, claims.Username); err != nil {
+		log.Printf("Error retrieving user '%s': %v", claims.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to disable two-factor authentication"))
+		return
+	}
+	if !checkPassword(user.Password, req.Password) {
+		apierror.Respond(c, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid password or two-factor code"))
+		return
+	}
+	if err := h.verifySecondFactor(claims.Username, req.Code, req.RecoveryCode); err != nil {
+		if errors.Is(err, errSecondFactorInvalid) {
+			apierror.Respond(c, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid password or two-factor code"))
+		} else {
+			log.Printf("Error verifying second factor of '%s': %v", claims.Username, err)
+			apierror.Respond(c, apierror.Internal("Failed to disable two-factor authentication"))
+		}
+		return
+	}
+
+	if err := models.DisableTwoFactor(h.DB, claims.Username); err != nil {
+		log.Printf("Error disabling two-factor authentication for '%s': %v", claims.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to disable two-factor authentication"))
+		return
+	}
+	middleware.LogSecurityEvent(c, "2fa_disabled", claims.Username)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "Two-factor authentication disabled")})
+}
+
+// ResetTwoFactor lets an admin remove a user's second factor, e.g. after a lost phone.
+// If the user's role requires two-factor authentication they must enrol again at their next login.
+func (h *AuthHandler) ResetTwoFactor(c *gin.Context) {
+	username := c.Param("username")
+
+	var user models.User
+	if err := models.GetUserByID(h.DB, &user, username); err != nil {
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrUserNotFound, "Failed to retrieve user"))
+		return
+	}
+	if err := models.DisableTwoFactor(h.DB, username); err != nil {
+		log.Printf("Error resetting two-factor authentication for '%s': %v", username, err)
+		apierror.Respond(c, apierror.Internal("Failed to reset two-factor authentication"))
+		return
+	}
+	middleware.LogSecurityEvent(c, "2fa_reset", username)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "Two-factor authentication of %s reset", username)})
+}
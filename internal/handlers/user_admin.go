@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/auth"
+	"order-notification-system/internal/i18n"
+	"order-notification-system/internal/middleware"
+	"order-notification-system/internal/models"
+	"order-notification-system/internal/validation"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SuspendUserRequest is the optional body of POST /api/users/:username/suspend.
+type SuspendUserRequest struct {
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+// ChangeRoleRequest is the body of PUT /api/users/:username/role.
+type ChangeRoleRequest struct {
+	Role string `json:"role" binding:"required,max=20"`
+}
+
+// ListUsers returns a page of users for administrators.
+// Query parameters: q (matches username or name, or exactly an email or phone number), role, status,
+// sort (username, first_name, last_name, role, status, created_at; prefix with - for descending), limit, offset.
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	limit, offset := parsePagination(c)
+	query := models.UserListQuery{
+		Search: strings.TrimSpace(c.Query("q")),
+		Role:   strings.ToLower(c.Query("role")),
+		Status: strings.ToLower(c.Query("status")),
+		Limit:  limit,
+		Offset: offset,
+	}
+	if query.Role != "" && !auth.IsValidRole(query.Role) {
+		apierror.Respond(c, apierror.BadRequest("Unknown role: %s", query.Role))
+		return
+	}
+	switch query.Status {
+	case "", models.UserStatusActive, models.UserStatusSuspended, models.UserStatusErased:
+	default:
+		apierror.Respond(c, apierror.BadRequest("status must be active, suspended or erased"))
+		return
+	}
+	if sort := c.Query("sort"); sort != "" {
+		query.Desc = strings.HasPrefix(sort, "-")
+		query.Sort = strings.TrimPrefix(sort, "-")
+		if !models.IsValidUserSort(query.Sort) {
+			apierror.Respond(c, apierror.BadRequest("Cannot sort by %s", query.Sort))
+			return
+		}
+	}
+
+	users, total, err := models.ListUsers(h.DB, query)
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		apierror.Respond(c, apierror.Internal("Failed to retrieve users"))
+		return
+	}
+	views := make([]AdminUserView, 0, len(users))
+	for i := range users {
+		views = append(views, NewAdminUserView(&users[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   views,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// SuspendUser blocks an account: its sessions end and it cannot log in until reactivated.
+func (h *UserHandler) SuspendUser(c *gin.Context) {
+	username := c.Param("username")
+	if claims, ok := middleware.GetClaims(c); ok && claims.Username == username {
+		apierror.Respond(c, apierror.BadRequest("You cannot suspend your own account"))
+		return
+	}
+
+	var req SuspendUserRequest
+	if c.Request.ContentLength > 0 {
+		if !validation.BindJSON(c, &req) {
+			return
+		}
+	}
+
+	if !h.setUserStatus(c, username, models.UserStatusSuspended, strings.TrimSpace(req.Reason)) {
+		return
+	}
+	if err := revokeAllSessions(username); err != nil {
+		log.Printf("Error revoking sessions of suspended user '%s': %v", username, err)
+	}
+	middleware.LogSecurityEvent(c, "user_suspended", username)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "User %s suspended", username)})
+}
+
+// ReactivateUser lifts a suspension.
+func (h *UserHandler) ReactivateUser(c *gin.Context) {
+	username := c.Param("username")
+	if !h.setUserStatus(c, username, models.UserStatusActive, "") {
+		return
+	}
+	middleware.LogSecurityEvent(c, "user_reactivated", username)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "User %s reactivated", username)})
+}
+
+// setUserStatus stores the new status and updates the token check cache. It writes the error response and returns false on failure.
+func (h *UserHandler) setUserStatus(c *gin.Context, username, status, reason string) bool {
+	if err := models.SetUserStatus(h.DB, username, status, reason); err != nil {
+		if errors.Is(err, models.ErrUserErased) {
+			apierror.Respond(c, apierror.ErrUserErased)
+			return false
+		}
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrUserNotFound, "Failed to update user status"))
+		return false
+	}
+	if store := auth.Revocations(); store != nil {
+		store.SetSuspended(username, status == models.UserStatusSuspended)
+	}
+	return true
+}
+
+// ChangeUserRole assigns a new role. The user's sessions end and their WebSocket connections are
+// closed, so the new role applies from their next login.
+func (h *UserHandler) ChangeUserRole(c *gin.Context) {
+	username := c.Param("username")
+	if claims, ok := middleware.GetClaims(c); ok && claims.Username == username {
+		apierror.Respond(c, apierror.BadRequest("You cannot change your own role"))
+		return
+	}
+
+	var req ChangeRoleRequest
+	if !validation.BindJSON(c, &req) {
+		return
+	}
+	role := strings.ToLower(strings.TrimSpace(req.Role))
+	if !auth.IsValidRole(role) {
+		validation.RespondField(c, "role", "role", "must be a known role")
+		return
+	}
+
+	if err := models.SetUserRole(h.DB, username, role); err != nil {
+		if errors.Is(err, models.ErrUserErased) {
+			apierror.Respond(c, apierror.ErrUserErased)
+			return
+		}
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrUserNotFound, "Failed to change role"))
+		return
+	}
+	if err := revokeAllSessions(username); err != nil {
+		log.Printf("Error revoking sessions of '%s' after role change: %v", username, err)
+	}
+	middleware.LogSecurityEvent(c, "role_changed:"+role, username)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "Role of %s changed to %s", username, role)})
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/i18n"
+	"order-notification-system/internal/middleware"
+	"order-notification-system/internal/models"
+	"order-notification-system/internal/validation"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateUserRequest is the body of PATCH /api/users/:username. Only the fields present are changed;
+// username, password, role and status have their own endpoints and are rejected here.
+type UpdateUserRequest struct {
+	Prefix      *string `json:"prefix" binding:"omitnil,max=20"`
+	FirstName   *string `json:"first_name" binding:"omitnil,notblank,max=100"`
+	LastName    *string `json:"last_name" binding:"omitnil,notblank,max=100"`
+	Email       *string `json:"email" binding:"omitnil,email,max=254"`
+	PhoneNumber *string `json:"phone_number" binding:"omitnil,phone"`
+	DateOfBirth *string `json:"date_of_birth" binding:"omitnil,birthdate"` // YYYY-MM-DD
+	Language    *string `json:"language" binding:"omitnil,language"`       // takes effect from the next token refresh
+}
+
+// columns returns the column updates for the fields present in a validated request.
+func (req *UpdateUserRequest) columns() map[string]interface{} {
+	fields := make(map[string]interface{})
+	setTrimmed := func(column string, value *string) {
+		if value != nil {
+			fields[column] = strings.TrimSpace(*value)
+		}
+	}
+	setTrimmed("prefix", req.Prefix)
+	setTrimmed("first_name", req.FirstName)
+	setTrimmed("last_name", req.LastName)
+	setTrimmed("email", req.Email)
+	setTrimmed("date_of_birth", req.DateOfBirth)
+	setTrimmed("language", req.Language)
+	if req.PhoneNumber != nil {
+		fields["phone_number"] = validation.NormalizePhone(*req.PhoneNumber)
+	}
+	return fields
+}
+
+// decodeStrict decodes a JSON body into v, reporting fields v does not have as validation errors.
+func decodeStrict(c *gin.Context, v interface{}) ([]validation.FieldError, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(v)
+	if err != nil && strings.HasPrefix(err.Error(), "json: unknown field ") {
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return []validation.FieldError{{Field: field, Rule: "unknown", Message: "cannot be changed here"}}, nil
+	}
+	if fieldErrors := validation.FromError(err); len(fieldErrors) > 0 {
+		return fieldErrors, nil
+	}
+	return nil, err
+}
+
+// UpdateUser applies a partial update to a user's profile. Omitted fields keep their value.
+// Changing the email clears its verified flag and sends a new verification link.
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	username := c.Param("username")
+
+	var existingUser models.User
+	if err := models.GetUserByID(h.DB, &existingUser, username); err != nil {
+		apierror.Respond(c, apierror.FromDB(err, apierror.ErrUserNotFound, "Failed to retrieve user"))
+		return
+	}
+
+	var req UpdateUserRequest
+	unknown, err := decodeStrict(c, &req)
+	if err != nil {
+		apierror.Respond(c, apierror.BadRequest("Invalid JSON request for update"))
+		return
+	}
+	if len(unknown) > 0 {
+		validation.Respond(c, unknown)
+		return
+	}
+	if fieldErrors := validation.Struct(&req); len(fieldErrors) > 0 {
+		validation.Respond(c, fieldErrors)
+		return
+	}
+	fields := req.columns()
+
+	emailChanged := false
+	if email, ok := fields["email"].(string); ok && !strings.EqualFold(email, existingUser.Email) {
+		emailChanged = true
+		fields["email_verified"] = false
+		fields["email_verified_at"] = nil
+	}
+	if len(fields) > 0 {
+		if err := models.UpdateUserFields(h.DB, username, fields); err != nil {
+			if errors.Is(err, models.ErrUserErased) {
+				apierror.Respond(c, apierror.ErrUserErased)
+				return
+			}
+			log.Printf("Error updating user '%s': %v", username, err)
+			apierror.Respond(c, apierror.Internal("Failed to update user"))
+			return
+		}
+	}
+
+	var user models.User
+	if err := models.GetUserByID(h.DB, &user, username); err != nil {
+		log.Printf("Error reloading user '%s': %v", username, err)
+		apierror.Respond(c, apierror.Internal("Failed to retrieve user"))
+		return
+	}
+	if emailChanged {
+		if err := h.sendVerificationEmail(&user); err != nil {
+			log.Printf("Error sending verification email to '%s': %v", user.Username, err)
+		}
+	}
+
+	claims, _ := middleware.GetClaims(c)
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": i18n.T(c, "User updated successfully"), "data": userViewFor(claims, &user)})
+}
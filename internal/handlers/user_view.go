@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"order-notification-system/internal/auth"
+	"order-notification-system/internal/models"
+	"time"
+)
+
+// Responses about users are always built from one of these views, never from models.User
+// directly. models.User.Password is also tagged json:"-", so a hash cannot be serialized
+// even if a handler forgets.
+
+// PublicUserView is what any authenticated caller may see about another user.
+type PublicUserView struct {
+	Username  string `json:"username"`
+	Prefix    string `json:"prefix"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// SelfUserView is what users see about their own account, including contact and personal details.
+type SelfUserView struct {
+	PublicUserView
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	PhoneNumber   string `json:"phone_number"`
+	DateOfBirth   string `json:"date_of_birth"`
+	Role          string `json:"role"`
+	Language      string `json:"language,omitempty"`
+}
+
+// AdminUserView is what callers with users:manage see, adding account administration details.
+type AdminUserView struct {
+	SelfUserView
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	Status          string     `json:"status"`
+	SuspendedAt     *time.Time `json:"suspended_at,omitempty"`
+	SuspendedReason string     `json:"suspended_reason,omitempty"`
+	CreatedAt       *time.Time `json:"created_at,omitempty"`
+}
+
+// NewPublicUserView builds the public view of user.
+func NewPublicUserView(user *models.User) PublicUserView {
+	return PublicUserView{
+		Username:  user.Username,
+		Prefix:    user.Prefix,
+		FirstName: user.First_name,
+		LastName:  user.Last_name,
+	}
+}
+
+// NewSelfUserView builds the view of user for the user themselves.
+func NewSelfUserView(user *models.User) SelfUserView {
+	return SelfUserView{
+		PublicUserView: NewPublicUserView(user),
+		Email:          user.Email,
+		EmailVerified:  user.EmailVerified,
+		PhoneNumber:    user.Phone_number,
+		DateOfBirth:    user.Date_of_birth,
+		Role:           auth.NormalizeRole(user.Role),
+		Language:       user.Language,
+	}
+}
+
+// NewAdminUserView builds the view of user for an administrator.
+func NewAdminUserView(user *models.User) AdminUserView {
+	view := AdminUserView{
+		SelfUserView:    NewSelfUserView(user),
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		Status:          user.Status,
+		SuspendedAt:     user.SuspendedAt,
+		SuspendedReason: user.SuspendedReason,
+	}
+	if !user.CreatedAt.IsZero() { // accounts created before the column existed have no date
+		view.CreatedAt = &user.CreatedAt
+	}
+	return view
+}
+
+// userViewFor picks the view of user that matches the caller's relationship to it:
+// admins get the admin view, users get the self view of their own account, and
+// everyone else gets the public view.
+func userViewFor(claims *auth.CustomClaims, user *models.User) interface{} {
+	switch {
+	case claims == nil:
+		return NewPublicUserView(user)
+	case claims.Can(auth.PermManageUsers):
+		return NewAdminUserView(user)
+	case !claims.IsAPIKey() && claims.Username == user.Username:
+		return NewSelfUserView(user)
+	default:
+		return NewPublicUserView(user)
+	}
+}
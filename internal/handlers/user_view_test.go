@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"order-notification-system/internal/auth"
+	"order-notification-system/internal/models"
+)
+
+const testPasswordHash = "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+
+func testUser() *models.User {
+	verifiedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &models.User{
+		Username:        "somchai",
+		Password:        testPasswordHash,
+		Prefix:          "Mr.",
+		First_name:      "Somchai",
+		Last_name:       "Jaidee",
+		Email:           "somchai@example.com",
+		Phone_number:    "0812345678",
+		Date_of_birth:   "1990-01-01",
+		Role:            auth.RoleCustomer,
+		Language:        "th",
+		EmailVerified:   true,
+		EmailVerifiedAt: &verifiedAt,
+		Status:          models.UserStatusActive,
+		CreatedAt:       verifiedAt,
+	}
+}
+
+func TestUserViewsNeverContainPasswordHash(t *testing.T) {
+	user := testUser()
+	tests := []struct {
+		name string
+		view interface{}
+	}{
+		{"public", NewPublicUserView(user)},
+		{"self", NewSelfUserView(user)},
+		{"admin", NewAdminUserView(user)},
+		{"model", user},
+		{"model list", []models.User{*user}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.view)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			for _, forbidden := range []string{`"password"`, "$2a$", testPasswordHash} {
+				if strings.Contains(string(body), forbidden) {
+					t.Errorf("JSON contains %q: %s", forbidden, body)
+				}
+			}
+		})
+	}
+}
+
+func TestUserViewFor(t *testing.T) {
+	user := testUser()
+	tests := []struct {
+		name   string
+		claims *auth.CustomClaims
+		want   interface{}
+	}{
+		{"no claims", nil, PublicUserView{}},
+		{"self", &auth.CustomClaims{Username: "somchai", Role: auth.RoleCustomer}, SelfUserView{}},
+		{"other customer", &auth.CustomClaims{Username: "somsri", Role: auth.RoleCustomer}, PublicUserView{}},
+		{"staff without users:manage", &auth.CustomClaims{Username: "chef", Role: auth.RoleKitchen}, PublicUserView{}},
+		{"admin", &auth.CustomClaims{Username: "root", Role: auth.RoleAdmin}, AdminUserView{}},
+		{"admin viewing themselves", &auth.CustomClaims{Username: "somchai", Role: auth.RoleAdmin}, AdminUserView{}},
+		{"API key of the user", &auth.CustomClaims{Username: "somchai", Role: auth.RoleCustomer, APIKeyID: 1}, PublicUserView{}},
+		{"API key with users:manage", &auth.CustomClaims{Username: "root", Role: auth.RoleAdmin, APIKeyID: 1,
+			Scopes: []auth.Permission{auth.PermManageUsers}}, AdminUserView{}},
+		{"API key scoped without users:manage", &auth.CustomClaims{Username: "root", Role: auth.RoleAdmin, APIKeyID: 1,
+			Scopes: []auth.Permission{auth.PermViewOrders}}, PublicUserView{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view := userViewFor(tt.claims, user)
+			var ok bool
+			switch tt.want.(type) {
+			case PublicUserView:
+				_, ok = view.(PublicUserView)
+			case SelfUserView:
+				_, ok = view.(SelfUserView)
+			case AdminUserView:
+				_, ok = view.(AdminUserView)
+			}
+			if !ok {
+				t.Fatalf("userViewFor returned %T, want %T", view, tt.want)
+			}
+
+			body, err := json.Marshal(view)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if strings.Contains(string(body), "$2a$") || strings.Contains(string(body), `"password"`) {
+				t.Errorf("JSON contains the password hash: %s", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IssueWebSocketTicket returns a short-lived, single-use ticket for opening /ws?ticket=...
+// The ticket stands in for the JWT so the token itself never appears in a URL.
+func (h *AuthHandler) IssueWebSocketTicket(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		apierror.Respond(c, apierror.ErrUnauthenticated)
+		return
+	}
+
+	ticket, expiresAt, err := h.Tickets.Issue(claims)
+	if err != nil {
+		log.Printf("Error issuing WebSocket ticket for '%s': %v", claims.Username, err)
+		apierror.Respond(c, apierror.Internal("Failed to issue WebSocket ticket"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"ticket":     ticket,
+		"expires_at": expiresAt,
+	})
+}
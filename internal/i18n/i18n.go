@@ -0,0 +1,150 @@
+// Package i18n translates API messages. Messages are written in English in the code and
+// double as catalog keys; locales/<language>.json maps them to other languages.
+// A message without a translation is returned in English.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"order-notification-system/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Supported languages.
+const (
+	English = "en"
+	Thai    = "th"
+)
+
+// ContextKey is the gin context key holding the language of the current request.
+const ContextKey = "language"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+var (
+	loadOnce sync.Once
+	catalogs map[string]map[string]string
+)
+
+// load reads every embedded catalog. English needs no catalog, since the messages are English.
+func load() {
+	loadOnce.Do(func() {
+		catalogs = map[string]map[string]string{English: {}}
+		entries, err := localeFiles.ReadDir("locales")
+		if err != nil {
+			log.Fatalf("Failed to read message catalogs: %v", err)
+		}
+		for _, entry := range entries {
+			data, err := localeFiles.ReadFile(path.Join("locales", entry.Name()))
+			if err != nil {
+				log.Fatalf("Failed to read message catalog %s: %v", entry.Name(), err)
+			}
+			var messages map[string]string
+			if err := json.Unmarshal(data, &messages); err != nil {
+				log.Fatalf("Failed to parse message catalog %s: %v", entry.Name(), err)
+			}
+			catalogs[strings.TrimSuffix(entry.Name(), ".json")] = messages
+		}
+	})
+}
+
+// Supported returns the supported language codes in alphabetical order.
+func Supported() []string {
+	load()
+	languages := make([]string, 0, len(catalogs))
+	for language := range catalogs {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// IsSupported reports whether language has a catalog.
+func IsSupported(language string) bool {
+	load()
+	_, ok := catalogs[language]
+	return ok
+}
+
+// Default returns DEFAULT_LANGUAGE when it is supported, and English otherwise.
+func Default() string {
+	language := strings.ToLower(config.GetEnv("DEFAULT_LANGUAGE", English))
+	if IsSupported(language) {
+		return language
+	}
+	return English
+}
+
+// Translate returns message in language, formatted with args when there are any.
+func Translate(language, message string, args ...interface{}) string {
+	load()
+	if translated, ok := catalogs[language][message]; ok && translated != "" {
+		message = translated
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// Negotiate picks the supported language the client prefers most in an Accept-Language
+// header, e.g. "th-TH,th;q=0.9,en;q=0.8". It returns Default() when none is supported.
+func Negotiate(acceptLanguage string) string {
+	best, bestQuality := "", 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if tag == "*" {
+			tag = Default()
+		}
+		// Match on the primary subtag, so th-TH selects th
+		if dash := strings.IndexByte(tag, '-'); dash >= 0 {
+			tag = tag[:dash]
+		}
+		if quality > bestQuality && IsSupported(tag) {
+			best, bestQuality = tag, quality
+		}
+	}
+	if best == "" {
+		return Default()
+	}
+	return best
+}
+
+// SetLanguage records the language of the request and announces it in Content-Language.
+func SetLanguage(c *gin.Context, language string) {
+	c.Set(ContextKey, language)
+	c.Header("Content-Language", language)
+}
+
+// FromContext returns the language of the request, or Default() when none was set.
+func FromContext(c *gin.Context) string {
+	if language := c.GetString(ContextKey); language != "" {
+		return language
+	}
+	return Default()
+}
+
+// T translates message into the language of the request.
+func T(c *gin.Context, message string, args ...interface{}) string {
+	return Translate(FromContext(c), message, args...)
+}
@@ -0,0 +1,119 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"order-notification-system/internal/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers email. Handlers depend on this interface so tests and
+// development setups can swap SMTP for a file or log sender.
+type Sender interface {
+	Send(msg Message) error
+}
+
+// NewSenderFromEnv builds the Sender selected by MAIL_DRIVER: "smtp" (default), "file" or "log".
+// It stops the program if the SMTP driver is selected without SMTP_HOST.
+func NewSenderFromEnv() Sender {
+	switch driver := config.GetEnv("MAIL_DRIVER", "smtp"); driver {
+	case "file":
+		return &FileSender{Dir: config.GetEnv("MAIL_FILE_DIR", "mail")}
+	case "log":
+		return &LogSender{}
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			// Falling back to the log would leak reset and verification links into it
+			log.Fatalf("❌ SMTP_HOST is not set (set it, or choose MAIL_DRIVER=file or MAIL_DRIVER=log explicitly)")
+		}
+		return &SMTPSender{
+			Host:     host,
+			Port:     config.GetEnv("SMTP_PORT", "587"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     config.GetEnv("MAIL_FROM", "no-reply@localhost"),
+		}
+	default:
+		log.Fatalf("❌ Unknown MAIL_DRIVER %q (use smtp, file or log)", driver)
+		return nil
+	}
+}
+
+// SMTPSender sends email through an SMTP server using STARTTLS when offered.
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send implements Sender.
+func (s *SMTPSender) Send(msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	addr := net.JoinHostPort(s.Host, s.Port)
+	if err := smtp.SendMail(addr, auth, s.From, []string{msg.To}, format(s.From, msg)); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// FileSender writes each email to a .eml file in Dir. Meant for development and tests.
+type FileSender struct {
+	Dir string
+}
+
+// Send implements Sender.
+func (s *FileSender) Send(msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), sanitize(msg.To))
+	return os.WriteFile(filepath.Join(s.Dir, name), format("no-reply@localhost", msg), 0600)
+}
+
+// LogSender writes emails to the application log. Meant for development only.
+type LogSender struct{}
+
+// Send implements Sender.
+func (s *LogSender) Send(msg Message) error {
+	log.Printf("📧 To: %s | Subject: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"order-notification-system/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader carries an API key for machine clients. "Authorization: ApiKey <key>" is accepted too.
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyFromRequest returns the API key sent with the request, if any.
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+	if authHeader := c.GetHeader("Authorization"); strings.HasPrefix(authHeader, "ApiKey ") {
+		return strings.TrimPrefix(authHeader, "ApiKey ")
+	}
+	return ""
+}
+
+// AuthenticateAPIKey checks a raw API key presented from ip and returns claims carrying its role and scopes.
+func AuthenticateAPIKey(key string, ip string) (*auth.CustomClaims, error) {
+	store := auth.APIKeys()
+	if store == nil {
+		return nil, errors.New("API keys are not enabled")
+	}
+	claims, err := store.Authenticate(key, ip)
+	if err != nil && !errors.Is(err, auth.ErrAPIKeyInvalid) {
+		log.Printf("Error checking API key: %v", err)
+	}
+	return claims, err
+}
+
+// recheckAPIKey fails if claims come from an API key that can no longer be used from ip.
+// Claims of other callers pass.
+func recheckAPIKey(claims *auth.CustomClaims, ip string) error {
+	if !claims.IsAPIKey() {
+		return nil
+	}
+	store := auth.APIKeys()
+	if store == nil {
+		return errors.New("API keys are not enabled")
+	}
+	err := store.Check(claims.APIKeyID, ip)
+	if err != nil && !errors.Is(err, auth.ErrAPIKeyInvalid) {
+		log.Printf("Error checking API key: %v", err)
+	}
+	return err
+}
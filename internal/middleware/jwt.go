@@ -1,81 +1,133 @@
 package middleware
 
 import (
+	"errors"
 	"log"
-	"net/http"
-	"os"
 	"strings"
 
+	"order-notification-system/internal/apierror"
 	"order-notification-system/internal/auth" // Import the new auth package
+	"order-notification-system/internal/i18n"
 
 	"github.com/gin-gonic/gin"
 )
 
-// JWTMiddleware validates JWT token in request header
+// JWTMiddleware validates JWT token in request header, or an API key (see APIKeyHeader)
 func JWTMiddleware() gin.HandlerFunc {
 	// Add Line Numbers to Log Output
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	return func(c *gin.Context) {
-		var tokenValue string
-
-		// ตรวจสอบว่าเป็น WebSocket upgrade request หรือไม่
-		isWebSocketUpgrade := c.GetHeader("Upgrade") == "websocket" &&
-			strings.Contains(strings.ToLower(c.GetHeader("Connection")), "upgrade")
-
-		if isWebSocketUpgrade {
-			tokenValue = c.Query("token") // ดึง token จาก query parameter ชื่อ "token"
-			if tokenValue == "" {
-				// สำหรับ WebSocket ถ้าไม่มี token ใน query parameter ให้ปฏิเสธการเชื่อมต่อ
-				// Client ควรส่ง token มาในรูปแบบ ws://host/ws?token=YOUR_TOKEN
-				// การตอบกลับด้วย JSON อาจจะไม่ถูกเห็นโดย client ws.onerror โดยตรง
-				// แต่การเชื่อมต่อจะล้มเหลว และ server ควร abort handshake
-				// log.Println("WebSocket connection attempt without token in query.")
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-					"status":  "error",
-					"message": "WebSocket authentication token is required as a query parameter 'token'",
-				})
+		// Machine clients send an API key instead of a JWT
+		if key := apiKeyFromRequest(c); key != "" {
+			claims, err := AuthenticateAPIKey(key, c.ClientIP())
+			if err != nil {
+				apierror.Respond(c, apierror.ErrInvalidAPIKey)
 				return
 			}
-		} else {
-			// สำหรับ HTTP request ปกติ ดึง token จาก Authorization header
-			authHeader := c.GetHeader("Authorization")
-			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-				c.JSON(http.StatusUnauthorized, gin.H{
-					"status":  "error",
-					"message": "Authorization header is required and must be Bearer token",
-				})
-				c.Abort()
-				return
-			}
-			tokenValue = strings.TrimPrefix(authHeader, "Bearer ")
+			setClaims(c, claims)
+			c.Next()
+			return
 		}
 
-		if tokenValue == "" { // ควรถูกดักจับโดยเงื่อนไขด้านบนแล้ว แต่เป็นการป้องกันอีกชั้น
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status":  "error",
-				"message": "Authentication token not provided or improperly formatted",
-			})
-			c.Abort()
+		// ดึง token จาก Authorization header
+		// WebSocket handshakes ใช้ WebSocketAuthMiddleware แทน เพื่อไม่ให้ token ไปอยู่ใน URL
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+			apierror.Respond(c, apierror.ErrUnauthenticated.WithDetail("Authorization header is required and must be Bearer token"))
 			return
 		}
+		tokenValue := strings.TrimPrefix(authHeader, "Bearer ")
 
-		// Use the new auth package for verification
-		if os.Getenv("JWT_SECRET_KEY") == "" {
-			log.Println("CRITICAL: JWT_SECRET_KEY is not set in environment variables.")
+		if tokenValue == "" { // ป้องกันอีกชั้นกรณี header เป็น "Bearer " เปล่าๆ
+			apierror.Respond(c, apierror.ErrUnauthenticated.WithDetail("Authentication token not provided or improperly formatted"))
+			return
 		}
-		token, claims, err := auth.VerifyToken(tokenValue)
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status":  "error",
-				"message": "Invalid or expired token",
-			})
-			c.Abort()
+
+		claims, err := AuthenticateToken(tokenValue)
+		if errors.Is(err, auth.ErrAccountSuspended) {
+			apierror.Respond(c, apierror.ErrAccountSuspended)
+			return
+		}
+		if err != nil {
+			apierror.Respond(c, apierror.ErrInvalidToken)
 			return
 		}
 
 		// Store claims in context for handlers to use
 		// claims is now *auth.CustomClaims from auth.VerifyToken
-		c.Set("claims", claims)
+		setClaims(c, claims)
+		c.Next()
+	}
+}
+
+// OptionalJWTMiddleware sets claims when a valid Bearer token or API key is present but lets anonymous requests through.
+// Credentials that are present but invalid are still rejected, so clients notice expired sessions.
+func OptionalJWTMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := apiKeyFromRequest(c); key != "" {
+			claims, err := AuthenticateAPIKey(key, c.ClientIP())
+			if err != nil {
+				apierror.Respond(c, apierror.ErrInvalidAPIKey)
+				return
+			}
+			setClaims(c, claims)
+			c.Next()
+			return
+		}
+
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.Next()
+			return
+		}
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			apierror.Respond(c, apierror.ErrInvalidToken.WithDetail("Authorization header must be Bearer token"))
+			return
+		}
+
+		claims, err := AuthenticateToken(strings.TrimPrefix(authHeader, "Bearer "))
+		if errors.Is(err, auth.ErrAccountSuspended) {
+			apierror.Respond(c, apierror.ErrAccountSuspended)
+			return
+		}
+		if err != nil {
+			apierror.Respond(c, apierror.ErrInvalidToken)
+			return
+		}
+		setClaims(c, claims)
 		c.Next()
 	}
 }
+
+// AuthenticateToken verifies a raw JWT and returns its claims.
+// It is shared by every transport that accepts a token (HTTP header, WebSocket handshake, WebSocket auth frame).
+func AuthenticateToken(tokenValue string) (*auth.CustomClaims, error) {
+	// Use the new auth package for verification
+	token, claims, err := auth.VerifyToken(tokenValue)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// setClaims stores the caller's claims for handlers and switches the request to the
+// caller's preferred language, if they have one.
+func setClaims(c *gin.Context, claims *auth.CustomClaims) {
+	c.Set("claims", claims)
+	if claims.Language != "" && i18n.IsSupported(claims.Language) {
+		i18n.SetLanguage(c, claims.Language)
+	}
+}
+
+// GetClaims returns the claims stored in the context by JWTMiddleware or WebSocketAuthMiddleware.
+func GetClaims(c *gin.Context) (*auth.CustomClaims, bool) {
+	value, exists := c.Get("claims")
+	if !exists {
+		return nil, false
+	}
+	claims, ok := value.(*auth.CustomClaims)
+	return claims, ok
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"order-notification-system/internal/i18n"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Language selects the language of the response from the Accept-Language header.
+// JWTMiddleware later switches to the caller's saved preference, if they have one.
+func Language() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Language")
+		i18n.SetLanguage(c, i18n.Negotiate(c.GetHeader("Accept-Language")))
+		c.Next()
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redactedQueryParams are query parameters whose values must never reach the access log.
+var redactedQueryParams = map[string]bool{
+	"token":  true,
+	"ticket": true,
+}
+
+// RedactedLogger is gin.Logger with credential-bearing query parameters masked.
+func RedactedLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		if param.Latency > time.Minute {
+			param.Latency = param.Latency.Truncate(time.Second)
+		}
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			param.StatusCode,
+			param.Latency,
+			param.ClientIP,
+			param.Method,
+			redactQuery(param.Path),
+			param.ErrorMessage,
+		)
+	})
+}
+
+// redactQuery masks sensitive parameter values in a path with a raw query, preserving parameter order.
+func redactQuery(path string) string {
+	idx := strings.IndexByte(path, '?')
+	if idx < 0 {
+		return path
+	}
+	pairs := strings.Split(path[idx+1:], "&")
+	for i, pair := range pairs {
+		key := pair
+		if eq := strings.IndexByte(pair, '='); eq >= 0 {
+			key = pair[:eq]
+		}
+		if redactedQueryParams[strings.ToLower(key)] {
+			pairs[i] = key + "=REDACTED"
+		}
+	}
+	return path[:idx+1] + strings.Join(pairs, "&")
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"log"
+
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission allows only callers whose role grants permission (and, for API keys, whose scopes include it).
+// It must run after JWTMiddleware.
+func RequirePermission(permission auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := GetClaims(c)
+		if !ok || !claims.Can(permission) {
+			denyAccess(c, "")
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSelfOrPermission allows the caller when the :username path parameter is
+// their own username, or when their role grants permission (e.g. an admin acting on another user).
+// API keys never count as "self".
+// It must run after JWTMiddleware.
+func RequireSelfOrPermission(permission auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		target := c.Param("username")
+		claims, ok := GetClaims(c)
+		isSelf := ok && !claims.IsAPIKey() && claims.Username == target
+		if !ok || (!isSelf && !claims.Can(permission)) {
+			denyAccess(c, target)
+			return
+		}
+		c.Next()
+	}
+}
+
+func denyAccess(c *gin.Context, target string) {
+	LogSecurityEvent(c, "access_denied", target)
+	apierror.Respond(c, apierror.ErrForbidden)
+}
+
+// LogSecurityEvent writes a single-line security event with the caller, route, target and client IP.
+func LogSecurityEvent(c *gin.Context, event string, target string) {
+	username, role := "-", "-"
+	if claims, ok := GetClaims(c); ok {
+		username, role = claims.Username, claims.Role
+	}
+	log.Printf("SECURITY event=%s user=%q role=%q method=%s path=%q target=%q ip=%s",
+		event, username, role, c.Request.Method, c.Request.URL.Path, target, c.ClientIP())
+}
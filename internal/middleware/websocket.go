@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/auth"
+	"order-notification-system/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketBearerProtocol is the Sec-WebSocket-Protocol entry that announces a token.
+// Browsers cannot set an Authorization header on a WebSocket, so clients send
+// the token as the next protocol entry instead:
+//
+//	new WebSocket(url, ["bearer", token])
+const WebSocketBearerProtocol = "bearer"
+
+// WebSocketAuthMiddleware authenticates WebSocket handshakes without requiring the JWT in the URL.
+// Credentials are accepted, in order:
+//  1. an API key in the X-API-Key header, for machine clients that can set headers
+//  2. a token in Sec-WebSocket-Protocol ("bearer", "<token>")
+//  3. a single-use ticket from POST /api/ws/ticket as ?ticket=
+//  4. the legacy ?token= query parameter, only when WS_ALLOW_QUERY_TOKEN=true
+//
+// If no credentials are present and WS_AUTH_FRAME_ENABLED is not false, the
+// request is passed on unauthenticated and the handler must receive an auth
+// frame as the first message.
+//
+// checkOrigin is the upgrader's origin check. It runs before any credential is
+// looked at, so a handshake from a forbidden origin cannot use up a single-use ticket.
+func WebSocketAuthMiddleware(tickets *auth.TicketStore, checkOrigin func(r *http.Request) bool) gin.HandlerFunc {
+	allowQueryToken := config.GetEnvBool("WS_ALLOW_QUERY_TOKEN", false)
+	allowAuthFrame := config.GetEnvBool("WS_AUTH_FRAME_ENABLED", true)
+
+	return func(c *gin.Context) {
+		if checkOrigin != nil && !checkOrigin(c.Request) {
+			abortWebSocketAuth(c, apierror.ErrForbidden.WithDetail("Origin not allowed"))
+			return
+		}
+
+		if key := c.GetHeader(APIKeyHeader); key != "" {
+			claims, err := AuthenticateAPIKey(key, c.ClientIP())
+			if err != nil {
+				abortWebSocketAuth(c, apierror.ErrInvalidAPIKey)
+				return
+			}
+			setClaims(c, claims)
+			c.Next()
+			return
+		}
+
+		if token := bearerFromSubprotocols(c.Request); token != "" {
+			claims, err := AuthenticateToken(token)
+			if err != nil {
+				abortWebSocketAuth(c, apierror.ErrInvalidToken)
+				return
+			}
+			setClaims(c, claims)
+			c.Next()
+			return
+		}
+
+		if ticket := c.Query("ticket"); ticket != "" {
+			claims, ok := tickets.Redeem(ticket)
+			// The credentials the ticket was minted with may have been revoked since
+			if !ok || auth.CheckRevoked(claims) != nil || recheckAPIKey(claims, c.ClientIP()) != nil {
+				abortWebSocketAuth(c, apierror.ErrInvalidToken.WithDetail("Invalid, used or expired WebSocket ticket"))
+				return
+			}
+			setClaims(c, claims)
+			c.Next()
+			return
+		}
+
+		if token := c.Query("token"); token != "" {
+			if !allowQueryToken {
+				log.Printf("Rejected WebSocket handshake with token in query from %s", c.ClientIP())
+				abortWebSocketAuth(c, apierror.ErrUnauthenticated.WithDetail("Passing the token as a query parameter is disabled; use the Sec-WebSocket-Protocol header or a ticket"))
+				return
+			}
+			claims, err := AuthenticateToken(token)
+			if err != nil {
+				abortWebSocketAuth(c, apierror.ErrInvalidToken)
+				return
+			}
+			setClaims(c, claims)
+			c.Next()
+			return
+		}
+
+		if !allowAuthFrame {
+			abortWebSocketAuth(c, apierror.ErrUnauthenticated.WithDetail("WebSocket authentication is required"))
+			return
+		}
+		// ไม่มี credentials ใน handshake: ให้ handler รอ auth frame เป็นข้อความแรก
+		c.Next()
+	}
+}
+
+// bearerFromSubprotocols returns the entry following "bearer" in Sec-WebSocket-Protocol, if any.
+func bearerFromSubprotocols(r *http.Request) string {
+	protocols := websocket.Subprotocols(r)
+	for i, protocol := range protocols {
+		if protocol == WebSocketBearerProtocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+	return ""
+}
+
+func abortWebSocketAuth(c *gin.Context, err *apierror.Error) {
+	// การตอบกลับด้วย JSON อาจจะไม่ถูกเห็นโดย client ws.onerror โดยตรง
+	// แต่การเชื่อมต่อจะล้มเหลว และ server ควร abort handshake
+	apierror.Respond(c, err)
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Announcement severities.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Announcement audiences. Station and role audiences are narrowed by AudienceValue.
+const (
+	AudienceAll     = "all"
+	AudienceStation = "station"
+	AudienceRole    = "role"
+)
+
+// Announcement is a message from a manager to staff screens, e.g. "grill is down".
+type Announcement struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Title         string    `gorm:"type:varchar(200)" json:"title"`
+	Message       string    `gorm:"type:text;not null" json:"message"`
+	Severity      string    `gorm:"type:varchar(10);not null;default:'info'" json:"severity"`
+	Audience      string    `gorm:"type:varchar(10);not null;default:'all'" json:"audience"`
+	AudienceValue string    `gorm:"type:varchar(50)" json:"audience_value,omitempty"`
+	ExpiresAt     time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedBy     string    `gorm:"type:varchar(100)" json:"created_by"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName specifies the table name for the Announcement model.
+func (Announcement) TableName() string {
+	return "announcements"
+}
+
+// AnnouncementDismissal records that a user has dismissed an announcement.
+type AnnouncementDismissal struct {
+	AnnouncementID uint      `gorm:"primaryKey" json:"announcement_id"`
+	Username       string    `gorm:"type:varchar(100);primaryKey" json:"username"`
+	DismissedAt    time.Time `gorm:"autoCreateTime" json:"dismissed_at"`
+}
+
+// TableName specifies the table name for the AnnouncementDismissal model.
+func (AnnouncementDismissal) TableName() string {
+	return "announcement_dismissals"
+}
+
+// IsValidSeverity reports whether severity is a known announcement severity.
+func IsValidSeverity(severity string) bool {
+	return severity == SeverityInfo || severity == SeverityWarning || severity == SeverityCritical
+}
+
+// IsValidAudience reports whether audience is a known announcement audience.
+func IsValidAudience(audience string) bool {
+	return audience == AudienceAll || audience == AudienceStation || audience == AudienceRole
+}
+
+// Matches reports whether a screen at station, logged in with role, is in the announcement's audience.
+func (a *Announcement) Matches(station, role string) bool {
+	switch a.Audience {
+	case AudienceAll:
+		return true
+	case AudienceStation:
+		return station != "" && station == a.AudienceValue
+	case AudienceRole:
+		return role != "" && role == a.AudienceValue
+	}
+	return false
+}
+
+// CreateAnnouncement inserts a new announcement.
+func CreateAnnouncement(db *gorm.DB, announcement *Announcement) error {
+	return db.Create(announcement).Error
+}
+
+// GetActiveAnnouncements returns unexpired announcements the user has not dismissed, newest first.
+// Audience filtering is left to the caller, which knows the screen's station.
+func GetActiveAnnouncements(db *gorm.DB, username string) ([]Announcement, error) {
+	announcements := []Announcement{}
+	err := db.Where("expires_at > ?", time.Now()).
+		Where("id NOT IN (?)", db.Model(&AnnouncementDismissal{}).Select("announcement_id").Where("username = ?", username)).
+		Order("created_at DESC, id DESC").
+		Find(&announcements).Error
+	return announcements, err
+}
+
+// DismissAnnouncement hides an announcement for a user. Dismissing twice is not an error.
+func DismissAnnouncement(db *gorm.DB, id uint, username string) error {
+	var announcement Announcement
+	if err := db.First(&announcement, "id = ?", id).Error; err != nil {
+		return err
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&AnnouncementDismissal{AnnouncementID: id, Username: username}).Error
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKey lets a machine client (POS terminal, delivery-platform bridge) call the API without a user password.
+// Only the hash of the key is stored; Prefix identifies the key in listings and logs.
+type APIKey struct {
+	ID      uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name    string `gorm:"type:varchar(100);not null" json:"name"`
+	Prefix  string `gorm:"type:varchar(16);not null;uniqueIndex" json:"prefix"`
+	KeyHash string `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	// Role is checked like a user's role; Scopes, if set, narrow it to the listed permissions.
+	Role   string `gorm:"type:varchar(20);not null" json:"role"`
+	Scopes string `gorm:"type:varchar(500)" json:"scopes"` // comma-separated permissions
+	// AllowedIPs is a comma-separated list of IPs and CIDR ranges; empty allows any address.
+	AllowedIPs string     `gorm:"type:varchar(1000)" json:"allowed_ips"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `gorm:"type:varchar(64)" json:"last_used_ip,omitempty"`
+	CreatedBy  string     `gorm:"type:varchar(100)" json:"created_by"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName specifies the table name for the APIKey model.
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// CreateAPIKey stores a new API key.
+func CreateAPIKey(db *gorm.DB, key *APIKey) error {
+	return db.Create(key).Error
+}
+
+// GetAPIKeyByHash returns the key with hash, or gorm.ErrRecordNotFound. Revoked and expired keys are returned too.
+func GetAPIKeyByHash(db *gorm.DB, hash string) (*APIKey, error) {
+	var key APIKey
+	if err := db.Where("key_hash = ?", hash).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetAPIKeyByID returns the key with id, or gorm.ErrRecordNotFound. Revoked and expired keys are returned too.
+func GetAPIKeyByID(db *gorm.DB, id uint) (*APIKey, error) {
+	var key APIKey
+	if err := db.First(&key, id).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListAPIKeys returns every API key, newest first.
+func ListAPIKeys(db *gorm.DB) ([]APIKey, error) {
+	var keys []APIKey
+	err := db.Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// RevokeAPIKey revokes the key with id and returns it, or gorm.ErrRecordNotFound.
+// Revoking an already revoked key keeps the original revocation time.
+func RevokeAPIKey(db *gorm.DB, id uint) (*APIKey, error) {
+	var key APIKey
+	if err := db.First(&key, id).Error; err != nil {
+		return nil, err
+	}
+	if key.RevokedAt == nil {
+		now := time.Now()
+		if err := db.Model(&key).Update("revoked_at", now).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &key, nil
+}
+
+// TouchAPIKey records that the key with id was used from ip.
+func TouchAPIKey(db *gorm.DB, id uint, ip string, usedAt time.Time) error {
+	return db.Model(&APIKey{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_used_at": usedAt, "last_used_ip": ip}).Error
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Lockout reasons.
+const (
+	LockoutReasonAccount = "account"
+	LockoutReasonIP      = "ip"
+)
+
+// LoginLockout records a temporary lockout after repeated failed logins.
+// Account lockouts are enforced from this table; IP lockouts are recorded for auditing.
+type LoginLockout struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Username    string     `gorm:"type:varchar(100);index" json:"username,omitempty"`
+	IP          string     `gorm:"type:varchar(64)" json:"ip"`
+	Reason      string     `gorm:"type:varchar(10);not null" json:"reason"`
+	LockedUntil time.Time  `gorm:"not null" json:"locked_until"`
+	UnlockedAt  *time.Time `json:"unlocked_at,omitempty"`
+	UnlockedBy  string     `gorm:"type:varchar(100)" json:"unlocked_by,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName specifies the table name for the LoginLockout model.
+func (LoginLockout) TableName() string {
+	return "login_lockouts"
+}
+
+// CreateLoginLockout records a lockout.
+func CreateLoginLockout(db *gorm.DB, lockout *LoginLockout) error {
+	return db.Create(lockout).Error
+}
+
+// GetActiveAccountLockout returns the current lockout of username, or gorm.ErrRecordNotFound.
+func GetActiveAccountLockout(db *gorm.DB, username string) (*LoginLockout, error) {
+	var lockout LoginLockout
+	err := db.Where("username = ? AND reason = ? AND unlocked_at IS NULL AND locked_until > ?",
+		username, LockoutReasonAccount, time.Now()).
+		Order("locked_until DESC").
+		First(&lockout).Error
+	if err != nil {
+		return nil, err
+	}
+	return &lockout, nil
+}
+
+// UnlockAccount ends all active lockouts of username and returns how many were lifted.
+func UnlockAccount(db *gorm.DB, username string, unlockedBy string) (int64, error) {
+	result := db.Model(&LoginLockout{}).
+		Where("username = ? AND reason = ? AND unlocked_at IS NULL AND locked_until > ?",
+			username, LockoutReasonAccount, time.Now()).
+		Updates(map[string]interface{}{"unlocked_at": time.Now(), "unlocked_by": unlockedBy})
+	return result.RowsAffected, result.Error
+}
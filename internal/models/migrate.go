@@ -0,0 +1,28 @@
+package models
+
+import "gorm.io/gorm"
+
+// AutoMigrate creates missing tables and columns for the models managed by the application.
+func AutoMigrate(db *gorm.DB) error {
+	// Per-user token cutoffs were replaced by revoked sessions
+	if err := db.Migrator().DropTable("token_cutoffs"); err != nil {
+		return err
+	}
+	return db.AutoMigrate(
+		&User{},
+		&Order{},
+		&Notification{},
+		&Announcement{},
+		&AnnouncementDismissal{},
+		&RefreshToken{},
+		&RevokedToken{},
+		&RevokedSession{},
+		&LoginLockout{},
+		&PasswordResetToken{},
+		&TwoFactorSecret{},
+		&RecoveryCode{},
+		&APIKey{},
+		&ProductTranslation{},
+		&PrivacyRequest{},
+	)
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notification types stored in a user's inbox.
+const (
+	NotificationOrderReady     = "order_ready"
+	NotificationOrderCancelled = "order_cancelled"
+	NotificationAnnouncement   = "announcement"
+)
+
+// Notification is a message kept in a user's inbox until they read it.
+type Notification struct {
+	ID       uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Username string `gorm:"type:varchar(100);not null;index:idx_notifications_user_read,priority:1" json:"username"`
+	Type     string `gorm:"type:varchar(30);not null" json:"type"`
+	Title    string `gorm:"type:varchar(200)" json:"title"`
+	Message  string `gorm:"type:text" json:"message"`
+	OrderID  *uint  `json:"order_id,omitempty"`
+	// AnnouncementID is set on notifications of type announcement
+	AnnouncementID *uint      `json:"announcement_id,omitempty"`
+	ReadAt         *time.Time `gorm:"index:idx_notifications_user_read,priority:2" json:"read_at"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName specifies the table name for the Notification model.
+func (Notification) TableName() string {
+	return "notifications"
+}
+
+// CreateNotification inserts a new notification.
+func CreateNotification(db *gorm.DB, notification *Notification) error {
+	return db.Create(notification).Error
+}
+
+// CreateAnnouncementNotifications records announcement in the inbox of every active user in
+// its audience and returns how many were written. Station audiences address screens rather than
+// people, so they write none.
+func CreateAnnouncementNotifications(db *gorm.DB, announcement *Announcement) (int64, error) {
+	users := db.Model(&User{}).Where("status = ?", UserStatusActive)
+	switch announcement.Audience {
+	case AudienceAll:
+	case AudienceRole:
+		if announcement.AudienceValue == "customer" {
+			// Accounts with no role are customers too
+			users = users.Where("role IN ?", []string{"customer", ""})
+		} else {
+			users = users.Where("role = ?", announcement.AudienceValue)
+		}
+	default:
+		return 0, nil
+	}
+
+	// Casts keep the parameter types explicit in the SELECT list
+	result := db.Exec("INSERT INTO notifications (username, type, title, message, announcement_id, created_at) ?",
+		users.Select("username, CAST(? AS text), CAST(? AS text), CAST(? AS text), CAST(? AS bigint), CAST(? AS timestamptz)",
+			NotificationAnnouncement, announcement.Title, announcement.Message, announcement.ID, announcement.CreatedAt))
+	return result.RowsAffected, result.Error
+}
+
+// ListNotifications returns a page of a user's notifications, newest first, and the total matching count.
+func ListNotifications(db *gorm.DB, username string, unreadOnly bool, limit, offset int) ([]Notification, int64, error) {
+	query := db.Model(&Notification{}).Where("username = ?", username)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	notifications := []Notification{}
+	err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&notifications).Error
+	return notifications, total, err
+}
+
+// SetNotificationRead marks one of the user's notifications read or unread.
+// It returns gorm.ErrRecordNotFound when the notification does not belong to the user.
+func SetNotificationRead(db *gorm.DB, username string, id uint, read bool) error {
+	result := db.Model(&Notification{}).
+		Where("id = ? AND username = ?", id, username).
+		Update("read_at", readAtValue(read))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetNotificationsRead marks the given notifications (or all of them when ids is empty) read or unread.
+// It returns the number of notifications changed.
+func SetNotificationsRead(db *gorm.DB, username string, ids []uint, read bool) (int64, error) {
+	query := db.Model(&Notification{}).Where("username = ?", username)
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	if read {
+		query = query.Where("read_at IS NULL")
+	} else {
+		query = query.Where("read_at IS NOT NULL")
+	}
+	result := query.Update("read_at", readAtValue(read))
+	return result.RowsAffected, result.Error
+}
+
+// CountUnreadNotifications returns how many unread notifications the user has.
+func CountUnreadNotifications(db *gorm.DB, username string) (int64, error) {
+	var count int64
+	err := db.Model(&Notification{}).Where("username = ? AND read_at IS NULL", username).Count(&count).Error
+	return count, err
+}
+
+func readAtValue(read bool) interface{} {
+	if read {
+		return time.Now()
+	}
+	return nil
+}
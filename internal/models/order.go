@@ -1,6 +1,45 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Order statuses. An order is "open" until it is completed or cancelled.
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPreparing = "preparing"
+	OrderStatusReady     = "ready"
+	OrderStatusCompleted = "completed"
+	OrderStatusCancelled = "cancelled"
+)
+
+// OpenOrderStatuses are the statuses a kitchen display shows by default.
+var OpenOrderStatuses = []string{OrderStatusPending, OrderStatusPreparing, OrderStatusReady}
+
+// IsValidOrderStatus reports whether status is one of the known order statuses.
+func IsValidOrderStatus(status string) bool {
+	switch status {
+	case OrderStatusPending, OrderStatusPreparing, OrderStatusReady, OrderStatusCompleted, OrderStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// ErrInvalidTransition is returned when an order cannot move to the requested status.
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+// CanTransitionOrder reports whether an order may move from one status to another.
+// Open orders may move to any status, so staff can correct a mistaken change;
+// completed and cancelled orders are final.
+func CanTransitionOrder(from, to string) bool {
+	if from == OrderStatusCompleted || from == OrderStatusCancelled {
+		return from == to
+	}
+	return IsValidOrderStatus(to)
+}
 
 type Order struct {
 	ID       uint    `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -9,6 +48,11 @@ type Order struct {
 	Quantity int     `json:"quantity"`
 	Price    float64 `gorm:"type:numeric" json:"price"`
 	Image    string  `gorm:"type:varchar" json:"image"`
+	Status   string  `gorm:"type:varchar(20);default:'pending'" json:"status"`
+	// Username is the customer who placed the order; empty for anonymous orders
+	Username string `gorm:"type:varchar(100);index" json:"username,omitempty"`
+	// Version increases on every status change so clients can discard stale events
+	Version int `gorm:"not null;default:1" json:"version"`
 }
 
 func (Order) TableName() string {
@@ -16,14 +60,46 @@ func (Order) TableName() string {
 }
 
 func CreateOrder(db *gorm.DB, order *Order) error {
+	// New orders always start pending at version 1
+	order.Status = OrderStatusPending
+	order.Version = 1
 	result := db.Create(order)
 	return result.Error
 }
 
-func UpdateOrderStatus(db *gorm.DB, id string, status string) error {
-	return db.Model(&Order{}).
-		Where("id = ?", id).
-		Update("status", status).Error
+// UpdateOrderStatus sets the status and bumps the version.
+// It returns the updated order together with the status it had before,
+// or ErrInvalidTransition, still with the current status, when CanTransitionOrder does not allow the change.
+// Setting the status an order already has changes nothing, not even the version.
+func UpdateOrderStatus(db *gorm.DB, id uint, status string) (*Order, string, error) {
+	var order Order
+	var previous string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "id = ?", id).Error; err != nil {
+			return err
+		}
+		previous = order.Status
+		if !CanTransitionOrder(previous, status) {
+			return ErrInvalidTransition
+		}
+		if previous == status {
+			return nil
+		}
+		if err := tx.Model(&order).Updates(map[string]interface{}{
+			"status":  status,
+			"version": gorm.Expr("version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.First(&order, "id = ?", id).Error
+	})
+	if errors.Is(err, ErrInvalidTransition) {
+		return nil, previous, err
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &order, previous, nil
 }
 
 // GetOrderByID ดึงข้อมูล Order ตาม ID
@@ -35,3 +111,10 @@ func GetOrderByID(db *gorm.DB, id string) (*Order, error) {
 	}
 	return &order, nil
 }
+
+// GetOrdersByStatus ดึง Order ทั้งหมดที่มีสถานะอยู่ใน statuses เรียงตาม ID
+func GetOrdersByStatus(db *gorm.DB, statuses []string) ([]Order, error) {
+	orders := []Order{}
+	err := db.Where("status IN ?", statuses).Order("id").Find(&orders).Error
+	return orders, err
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrResetTokenInvalid means the reset token is unknown, already used or expired.
+var ErrResetTokenInvalid = errors.New("password reset token is invalid or expired")
+
+// PasswordResetToken is a hashed, single-use token sent by email to reset a password.
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Username  string     `gorm:"type:varchar(100);not null;index" json:"username"`
+	TokenHash string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName specifies the table name for the PasswordResetToken model.
+func (PasswordResetToken) TableName() string {
+	return "password_reset_tokens"
+}
+
+// CreatePasswordResetToken stores a new reset token and invalidates the user's earlier unused ones.
+func CreatePasswordResetToken(db *gorm.DB, token *PasswordResetToken) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&PasswordResetToken{}).
+			Where("username = ? AND used_at IS NULL", token.Username).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+// ConsumePasswordResetToken marks the token with hash used and calls apply with its username
+// inside the same transaction, so the token is only spent if apply succeeds.
+func ConsumePasswordResetToken(db *gorm.DB, hash string, apply func(tx *gorm.DB, username string) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var token PasswordResetToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hash, time.Now()).
+			First(&token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrResetTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&token).Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return apply(tx, token.Username)
+	})
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Privacy request types.
+const (
+	PrivacyRequestExport  = "export"
+	PrivacyRequestErasure = "erasure"
+)
+
+// ErrUserErased is returned when a change is attempted on an erased account.
+var ErrUserErased = errors.New("user has been erased")
+
+// PrivacyRequest is the audit record of a personal data export or erasure.
+type PrivacyRequest struct {
+	ID   uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Type string `gorm:"type:varchar(10);not null;index" json:"type"`
+	// Subject is the account whose data it was; after an erasure it is the account's pseudonym
+	Subject     string `gorm:"type:varchar(100);not null;index" json:"subject"`
+	RequestedBy string `gorm:"type:varchar(100);not null" json:"requested_by"`
+	// OnBehalf is set when an administrator acted for the user
+	OnBehalf  bool      `gorm:"not null;default:false" json:"on_behalf"`
+	Format    string    `gorm:"type:varchar(10)" json:"format,omitempty"` // exports only: json or zip
+	Reason    string    `gorm:"type:varchar(255)" json:"reason,omitempty"`
+	IP        string    `gorm:"type:varchar(64)" json:"ip"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName specifies the table name for the PrivacyRequest model.
+func (PrivacyRequest) TableName() string {
+	return "privacy_requests"
+}
+
+// CreatePrivacyRequest records a privacy request.
+func CreatePrivacyRequest(db *gorm.DB, request *PrivacyRequest) error {
+	return db.Create(request).Error
+}
+
+// ListPrivacyRequests returns a page of privacy requests, newest first, and the total matching count.
+// An empty subject lists the requests about every account.
+func ListPrivacyRequests(db *gorm.DB, subject string, limit, offset int) ([]PrivacyRequest, int64, error) {
+	query := db.Model(&PrivacyRequest{})
+	if subject != "" {
+		query = query.Where("subject = ?", subject)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	requests := []PrivacyRequest{}
+	err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&requests).Error
+	return requests, total, err
+}
+
+// UserData is everything stored about a user that an export returns.
+type UserData struct {
+	User          User
+	Orders        []Order
+	Notifications []Notification
+}
+
+// GetUserData loads the account, orders and notifications of username.
+// It returns gorm.ErrRecordNotFound for an unknown user.
+func GetUserData(db *gorm.DB, username string) (*UserData, error) {
+	data := &UserData{Orders: []Order{}, Notifications: []Notification{}}
+	if err := GetUserByID(db, &data.User, username); err != nil {
+		return nil, err
+	}
+	if err := db.Where("username = ?", username).Order("id").Find(&data.Orders).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("username = ?", username).Order("created_at, id").Find(&data.Notifications).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// EraseUser anonymizes the account of username in one transaction and records request.
+// The account is renamed to pseudonym and its personal fields and password are cleared;
+// orders stay for accounting under the pseudonym. Notifications, sessions, reset tokens,
+// two-factor secrets and dismissals are deleted, and audit records that name the user,
+// including earlier privacy requests, are moved to the pseudonym.
+// It returns gorm.ErrRecordNotFound for an unknown user and ErrUserErased if already erased.
+func EraseUser(db *gorm.DB, username, pseudonym string, request *PrivacyRequest) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("username = ?", username).First(&user).Error; err != nil {
+			return err
+		}
+		if user.IsErased() {
+			return ErrUserErased
+		}
+
+		now := time.Now()
+		fields := map[string]interface{}{
+			"username":          pseudonym,
+			"password":          "",
+			"prefix":            "",
+			"first_name":        "",
+			"last_name":         "",
+			"email":             "",
+			"phone_number":      "",
+			"date_of_birth":     "",
+			"language":          "",
+			"email_verified":    false,
+			"email_verified_at": nil,
+			"status":            UserStatusErased,
+			"suspended_at":      nil,
+			"suspended_reason":  "",
+			"erased_at":         now,
+		}
+		if err := encryptUserColumns(fields); err != nil {
+			return err
+		}
+		if err := tx.Model(&User{}).Where("username = ?", username).Updates(fields).Error; err != nil {
+			return err
+		}
+
+		renames := []struct {
+			model  interface{}
+			column string
+		}{
+			{&Order{}, "username"},
+			{&LoginLockout{}, "username"},
+			{&LoginLockout{}, "unlocked_by"},
+			{&RevokedToken{}, "username"},
+			{&APIKey{}, "created_by"},
+			{&Announcement{}, "created_by"},
+			{&PrivacyRequest{}, "subject"},
+			{&PrivacyRequest{}, "requested_by"},
+		}
+		for _, rename := range renames {
+			if err := tx.Model(rename.model).Where(rename.column+" = ?", username).Update(rename.column, pseudonym).Error; err != nil {
+				return err
+			}
+		}
+
+		deletes := []interface{}{
+			&Notification{},
+			&RefreshToken{},
+			&PasswordResetToken{},
+			&TwoFactorSecret{},
+			&RecoveryCode{},
+			&AnnouncementDismissal{},
+		}
+		for _, model := range deletes {
+			if err := tx.Where("username = ?", username).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		request.Subject = pseudonym
+		if request.RequestedBy == username {
+			request.RequestedBy = pseudonym
+		}
+		return tx.Create(request).Error
+	})
+}
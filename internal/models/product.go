@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Product defines the structure for product data based on your table schema.
@@ -29,12 +30,88 @@ func GetProductByID(db *gorm.DB, product *Product, productID string) error {
 	return db.Where("product_id = ?", productID).First(product).Error
 }
 
-// CreateProduct inserts a new product into the database.
-func CreateProduct(db *gorm.DB, product *Product) error {
-	return db.Create(product).Error
+// CreateProduct inserts a new product and its translations in one transaction.
+func CreateProduct(db *gorm.DB, product *Product, translations ...ProductTranslation) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(product).Error; err != nil {
+			return err
+		}
+		for i := range translations {
+			translations[i].ProductID = product.ProductID
+			if err := tx.Create(&translations[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 // GetAllProducts retrieves all products from the database.
 func GetAllProducts(db *gorm.DB, products *[]Product) error {
 	return db.Find(products).Error
 }
+
+// ProductTranslation holds the name and description of a product in one language.
+// The columns of the product itself are the untranslated fallback.
+type ProductTranslation struct {
+	ProductID   string    `gorm:"type:varchar(10);primaryKey" json:"product_id"`
+	Language    string    `gorm:"type:varchar(5);primaryKey" json:"language"`
+	Name        string    `gorm:"type:varchar(100);not null" json:"name"`
+	Description *string   `gorm:"type:text" json:"description,omitempty"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName specifies the table name for the ProductTranslation model.
+func (ProductTranslation) TableName() string {
+	return "product_translation"
+}
+
+// LocalizeProducts replaces the name and description of products with their translation
+// into language, where one exists. Products without a translation are left as they are.
+func LocalizeProducts(db *gorm.DB, products []Product, language string) error {
+	if len(products) == 0 {
+		return nil
+	}
+	ids := make([]string, len(products))
+	for i := range products {
+		ids[i] = products[i].ProductID
+	}
+	var translations []ProductTranslation
+	if err := db.Where("product_id IN ? AND language = ?", ids, language).Find(&translations).Error; err != nil {
+		return err
+	}
+	byProduct := make(map[string]ProductTranslation, len(translations))
+	for _, translation := range translations {
+		byProduct[translation.ProductID] = translation
+	}
+	for i := range products {
+		if translation, ok := byProduct[products[i].ProductID]; ok {
+			products[i].Name = translation.Name
+			if translation.Description != nil {
+				products[i].Description = translation.Description
+			}
+		}
+	}
+	return nil
+}
+
+// SaveProductTranslation creates or replaces the translation of a product into one language.
+func SaveProductTranslation(db *gorm.DB, translation *ProductTranslation) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "language"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description", "updated_at"}),
+	}).Create(translation).Error
+}
+
+// DeleteProductTranslation removes the translation of a product into language.
+// It returns gorm.ErrRecordNotFound when there was none.
+func DeleteProductTranslation(db *gorm.DB, productID, language string) error {
+	result := db.Where("product_id = ? AND language = ?", productID, language).Delete(&ProductTranslation{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
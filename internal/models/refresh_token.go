@@ -0,0 +1,106 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrRefreshTokenInvalid means the refresh token is unknown or expired.
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	// ErrRefreshTokenReused means an already rotated or revoked refresh token was presented;
+	// its whole family has been revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// RefreshToken is a hashed refresh token. Tokens issued by rotating one another share a FamilyID.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Username  string     `gorm:"type:varchar(100);not null;index" json:"username"`
+	FamilyID  string     `gorm:"type:varchar(64);not null;index" json:"family_id"`
+	TokenHash string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName specifies the table name for the RefreshToken model.
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// CreateRefreshToken inserts a new refresh token.
+func CreateRefreshToken(db *gorm.DB, token *RefreshToken) error {
+	return db.Create(token).Error
+}
+
+// RotateRefreshToken consumes the refresh token with hash and stores next in the same family.
+// next.Username and next.FamilyID are filled from the consumed token.
+// Presenting a token that was already used or revoked revokes the whole family and returns ErrRefreshTokenReused;
+// next.Username and next.FamilyID then identify the owner and the family.
+func RotateRefreshToken(db *gorm.DB, hash string, next *RefreshToken) error {
+	reused := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var current RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", hash).First(&current).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRefreshTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		if current.UsedAt != nil || current.RevokedAt != nil {
+			// Commit the family revocation, then report reuse
+			reused = true
+			next.Username = current.Username
+			next.FamilyID = current.FamilyID
+			return revokeRefreshTokens(tx.Where("family_id = ?", current.FamilyID))
+		}
+		if time.Now().After(current.ExpiresAt) {
+			return ErrRefreshTokenInvalid
+		}
+
+		now := time.Now()
+		if err := tx.Model(&current).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		next.Username = current.Username
+		next.FamilyID = current.FamilyID
+		return tx.Create(next).Error
+	})
+	if err != nil {
+		return err
+	}
+	if reused {
+		return ErrRefreshTokenReused
+	}
+	return nil
+}
+
+// RevokeRefreshTokenFamily revokes every token in a family.
+func RevokeRefreshTokenFamily(db *gorm.DB, familyID string) error {
+	return revokeRefreshTokens(db.Where("family_id = ?", familyID))
+}
+
+// GetRecentSessionIDs returns the token families of username that issued a refresh token, and
+// with it an access token, since the given time.
+func GetRecentSessionIDs(db *gorm.DB, username string, since time.Time) ([]string, error) {
+	var familyIDs []string
+	err := db.Model(&RefreshToken{}).Distinct("family_id").
+		Where("username = ? AND created_at >= ?", username, since).Pluck("family_id", &familyIDs).Error
+	return familyIDs, err
+}
+
+// RevokeUserRefreshTokens revokes every refresh token of a user.
+func RevokeUserRefreshTokens(db *gorm.DB, username string) error {
+	return revokeRefreshTokens(db.Where("username = ?", username))
+}
+
+func revokeRefreshTokens(scope *gorm.DB) error {
+	return scope.Model(&RefreshToken{}).Where("revoked_at IS NULL").Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RevokedToken is an access token (by jti) that must be rejected until it would have expired anyway.
+type RevokedToken struct {
+	JTI       string    `gorm:"column:jti;type:varchar(64);primaryKey" json:"jti"`
+	Username  string    `gorm:"type:varchar(100);not null;index" json:"username"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	RevokedAt time.Time `gorm:"autoCreateTime" json:"revoked_at"`
+}
+
+// TableName specifies the table name for the RevokedToken model.
+func (RevokedToken) TableName() string {
+	return "revoked_tokens"
+}
+
+// RevokedSession rejects every access token of a login (by sid) until the last one issued would
+// have expired anyway ("log out everywhere"). The refresh tokens of the login are revoked with it,
+// so no further access token is issued for the session.
+type RevokedSession struct {
+	SessionID string    `gorm:"type:varchar(64);primaryKey" json:"session_id"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	RevokedAt time.Time `gorm:"autoCreateTime" json:"revoked_at"`
+}
+
+// TableName specifies the table name for the RevokedSession model.
+func (RevokedSession) TableName() string {
+	return "revoked_sessions"
+}
+
+// RevokeToken records a revoked access token. Revoking twice is not an error.
+func RevokeToken(db *gorm.DB, token *RevokedToken) error {
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(token).Error
+}
+
+// GetActiveRevokedTokens returns revoked tokens that have not expired yet.
+func GetActiveRevokedTokens(db *gorm.DB) ([]RevokedToken, error) {
+	tokens := []RevokedToken{}
+	err := db.Where("expires_at > ?", time.Now()).Find(&tokens).Error
+	return tokens, err
+}
+
+// PurgeExpiredRevokedTokens deletes revoked tokens and sessions that have expired on their own.
+func PurgeExpiredRevokedTokens(db *gorm.DB) error {
+	if err := db.Where("expires_at <= ?", time.Now()).Delete(&RevokedToken{}).Error; err != nil {
+		return err
+	}
+	return db.Where("expires_at <= ?", time.Now()).Delete(&RevokedSession{}).Error
+}
+
+// RevokeSessions records revoked sessions. Revoking a session again moves its expiry forward.
+func RevokeSessions(db *gorm.DB, sessionIDs []string, expiresAt time.Time) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+	sessions := make([]RevokedSession, 0, len(sessionIDs))
+	for _, id := range sessionIDs {
+		sessions = append(sessions, RevokedSession{SessionID: id, ExpiresAt: expiresAt})
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "session_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"expires_at"}),
+	}).Create(&sessions).Error
+}
+
+// GetActiveRevokedSessions returns revoked sessions that have not expired yet.
+func GetActiveRevokedSessions(db *gorm.DB) ([]RevokedSession, error) {
+	sessions := []RevokedSession{}
+	err := db.Where("expires_at > ?", time.Now()).Find(&sessions).Error
+	return sessions, err
+}
@@ -0,0 +1,232 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"order-notification-system/internal/fieldcrypt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrTOTPCodeReused means a TOTP code from the same or an earlier time step was already accepted.
+	ErrTOTPCodeReused = errors.New("TOTP code was already used")
+	// ErrTwoFactorEnabled means the user already has an enabled TOTP secret.
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrRecoveryCodeInvalid means the recovery code is unknown or already used.
+	ErrRecoveryCodeInvalid = errors.New("recovery code is invalid or already used")
+)
+
+// TwoFactorSecret is a user's TOTP secret. It is stored unconfirmed at enrolment and
+// enabled once the user proves their authenticator app produces matching codes.
+// The secret is encrypted at rest (see fieldcrypt).
+type TwoFactorSecret struct {
+	Username string `gorm:"primaryKey;type:varchar(100)" json:"username"`
+	Secret   string `gorm:"type:varchar(255);not null;serializer:encrypted" json:"-"`
+	Enabled  bool   `gorm:"not null;default:false" json:"enabled"`
+	// LastUsedStep is the time step of the last accepted code; codes up to it are rejected as replays.
+	LastUsedStep int64      `gorm:"not null;default:0" json:"-"`
+	ConfirmedAt  *time.Time `json:"confirmed_at,omitempty"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName specifies the table name for the TwoFactorSecret model.
+func (TwoFactorSecret) TableName() string {
+	return "two_factor_secrets"
+}
+
+// RecoveryCode is a hashed one-time code that replaces a TOTP code when the authenticator is lost.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Username  string     `gorm:"type:varchar(100);not null;index" json:"username"`
+	CodeHash  string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName specifies the table name for the RecoveryCode model.
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
+
+// twoFactorSecretColumn is the associated data of the encrypted secret column.
+var twoFactorSecretColumn = fieldcrypt.ColumnName("two_factor_secrets", "secret")
+
+// GetTwoFactorSecret returns the TOTP secret of username, or gorm.ErrRecordNotFound.
+func GetTwoFactorSecret(db *gorm.DB, username string) (*TwoFactorSecret, error) {
+	var secret TwoFactorSecret
+	if err := db.Where("username = ?", username).First(&secret).Error; err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// SavePendingTwoFactorSecret stores a new, not yet enabled secret for username,
+// replacing an earlier unconfirmed one. If the user's secret is already enabled it is
+// left untouched and ErrTwoFactorEnabled is returned.
+func SavePendingTwoFactorSecret(db *gorm.DB, username, secret string) error {
+	// The update is a map, which bypasses the serializer
+	encrypted, err := fieldcrypt.Encrypt(twoFactorSecretColumn, secret)
+	if err != nil {
+		return err
+	}
+	result := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "username"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"secret": encrypted, "last_used_step": 0, "updated_at": time.Now()}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Eq{Column: clause.Column{Table: "two_factor_secrets", Name: "enabled"}, Value: false}}},
+	}).Create(&TwoFactorSecret{Username: username, Secret: secret})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+// EnableTwoFactor enables the pending secret of username after a code from step was
+// accepted and replaces the user's recovery codes with codeHashes.
+func EnableTwoFactor(db *gorm.DB, username string, step int64, codeHashes []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&TwoFactorSecret{}).
+			Where("username = ? AND enabled = ?", username, false).
+			Updates(map[string]interface{}{"enabled": true, "confirmed_at": now, "last_used_step": step})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return replaceRecoveryCodes(tx, username, codeHashes)
+	})
+}
+
+// RecordTOTPStep marks the code from step as used. It fails with ErrTOTPCodeReused if a
+// code from that step or a later one was already accepted.
+func RecordTOTPStep(db *gorm.DB, username string, step int64) error {
+	result := db.Model(&TwoFactorSecret{}).
+		Where("username = ? AND last_used_step < ?", username, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTOTPCodeReused
+	}
+	return nil
+}
+
+// ConsumeRecoveryCode marks the recovery code with hash as used, or returns ErrRecoveryCodeInvalid.
+func ConsumeRecoveryCode(db *gorm.DB, username, hash string) error {
+	result := db.Model(&RecoveryCode{}).
+		Where("username = ? AND code_hash = ? AND used_at IS NULL", username, hash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes discards the user's recovery codes and stores codeHashes instead.
+func ReplaceRecoveryCodes(db *gorm.DB, username string, codeHashes []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, username, codeHashes)
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, username string, codeHashes []string) error {
+	if err := tx.Where("username = ?", username).Delete(&RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, RecoveryCode{Username: username, CodeHash: hash})
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
+
+// CountUnusedRecoveryCodes returns how many recovery codes username has left.
+func CountUnusedRecoveryCodes(db *gorm.DB, username string) (int64, error) {
+	var count int64
+	err := db.Model(&RecoveryCode{}).Where("username = ? AND used_at IS NULL", username).Count(&count).Error
+	return count, err
+}
+
+// DisableTwoFactor removes the TOTP secret and recovery codes of username.
+func DisableTwoFactor(db *gorm.DB, username string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("username = ?", username).Delete(&TwoFactorSecret{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("username = ?", username).Delete(&RecoveryCode{}).Error
+	})
+}
+
+// ReencryptTwoFactorSecrets rewrites, batchSize rows at a time, every TOTP secret that is plaintext
+// or encrypted with a key other than the active one. Like ReencryptUsers, a row is only rewritten
+// if it has not changed since it was read.
+func ReencryptTwoFactorSecrets(db *gorm.DB, batchSize int, dryRun bool) (ReencryptStats, error) {
+	var stats ReencryptStats
+	active, err := fieldcrypt.ActiveKeyID()
+	if err != nil {
+		return stats, err
+	}
+
+	last := ""
+	for {
+		var rows []struct {
+			Username string
+			Secret   string
+		}
+		err := db.Table("two_factor_secrets").Select("username, secret").
+			Where("username > ?", last).Order("username").Limit(batchSize).Scan(&rows).Error
+		if err != nil {
+			return stats, err
+		}
+		if len(rows) == 0 {
+			return stats, nil
+		}
+
+		for _, row := range rows {
+			stats.Scanned++
+			last = row.Username
+			if fieldcrypt.KeyID(row.Secret) == active {
+				continue
+			}
+			secret, err := fieldcrypt.Decrypt(twoFactorSecretColumn, row.Secret)
+			if err != nil {
+				return stats, fmt.Errorf("two-factor secret of %s: %w", row.Username, err)
+			}
+			if dryRun {
+				stats.Updated++
+				continue
+			}
+			encrypted, err := fieldcrypt.Encrypt(twoFactorSecretColumn, secret)
+			if err != nil {
+				return stats, err
+			}
+			result := db.Table("two_factor_secrets").
+				Where("username = ? AND secret = ?", row.Username, row.Secret).
+				UpdateColumn("secret", encrypted)
+			if result.Error != nil {
+				return stats, fmt.Errorf("two-factor secret of %s: %w", row.Username, result.Error)
+			}
+			if result.RowsAffected == 0 {
+				stats.Skipped++
+			} else {
+				stats.Updated++
+			}
+		}
+	}
+}
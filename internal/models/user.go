@@ -1,23 +1,161 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"order-notification-system/internal/fieldcrypt"
+
+	"gorm.io/gorm"
+)
 
 // User ...
 type User struct {
-	Username      string `json:"username" gorm:"primary_key"`
-	Password      string `json:"password"`
-	Prefix        string `json:"prefix"`
-	First_name    string `json:"first_name"`
-	Last_name     string `json:"last_name"`
-	Email         string `json:"email"`
-	Phone_number  string `json:"phone_number"`
-	Date_of_birth string `json:"date_of_birth"`
+	Username   string `json:"username" gorm:"primary_key"`
+	Password   string `json:"-"` // bcrypt hash; never serialized
+	Prefix     string `json:"prefix"`
+	First_name string `json:"first_name"`
+	Last_name  string `json:"last_name"`
+	// Email, Phone_number and Date_of_birth are encrypted at rest (see fieldcrypt); look users up
+	// by email or phone through EmailIndex and PhoneIndex, never through the columns themselves
+	Email         string `json:"email" gorm:"serializer:encrypted"`
+	Phone_number  string `json:"phone_number" gorm:"serializer:encrypted"`
+	Date_of_birth string `json:"date_of_birth" gorm:"serializer:encrypted"`
+	EmailIndex    string `json:"-" gorm:"type:varchar(64);index"`
+	PhoneIndex    string `json:"-" gorm:"type:varchar(64);index"`
+	Role          string `json:"role" gorm:"type:varchar(20);not null;default:'customer'"`
+	// Language is the preferred language of API messages (en, th); empty follows Accept-Language
+	Language string `json:"language" gorm:"type:varchar(5);not null;default:''"`
+	// EmailVerified is set once the user follows the verification link (or an admin verifies them)
+	EmailVerified   bool       `json:"email_verified" gorm:"not null;default:false"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// Status is active, suspended or erased; suspended users cannot log in and their tokens stop working
+	Status          string     `json:"status" gorm:"type:varchar(20);not null;default:'active';index"`
+	SuspendedAt     *time.Time `json:"suspended_at,omitempty"`
+	SuspendedReason string     `json:"suspended_reason,omitempty" gorm:"type:varchar(255)"`
+	// ErasedAt is set when the account was anonymized after an erasure request
+	ErasedAt  *time.Time `json:"erased_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// User statuses.
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	// UserStatusErased accounts were anonymized; they keep their orders but cannot be used again
+	UserStatusErased = "erased"
+)
+
+// IsSuspended reports whether the account is suspended.
+func (u *User) IsSuspended() bool {
+	return u.Status == UserStatusSuspended
+}
+
+// IsErased reports whether the account was anonymized.
+func (u *User) IsErased() bool {
+	return u.Status == UserStatusErased
+}
+
+// UserListQuery filters, sorts and pages ListUsers.
+type UserListQuery struct {
+	// Search matches part of the username, first or last name, ignoring case, or a whole
+	// email address or phone number (they are encrypted, so only exact matches are possible)
+	Search string
+	Role   string
+	Status string
+	// Sort is one of userSortColumns; Desc reverses it
+	Sort   string
+	Desc   bool
+	Limit  int
+	Offset int
+}
+
+// userSortColumns are the columns ListUsers can sort by.
+var userSortColumns = map[string]bool{
+	"username":   true,
+	"first_name": true,
+	"last_name":  true,
+	"role":       true,
+	"status":     true,
+	"created_at": true,
+}
+
+// IsValidUserSort reports whether ListUsers can sort by column.
+func IsValidUserSort(column string) bool {
+	return userSortColumns[column]
 }
 
 func (u *User) TableName() string {
 	return "users"
 }
 
+// Associated data of the encrypted user columns and their blind indexes.
+var (
+	userEmailColumn = fieldcrypt.ColumnName("users", "email")
+	userPhoneColumn = fieldcrypt.ColumnName("users", "phone_number")
+	userBirthColumn = fieldcrypt.ColumnName("users", "date_of_birth")
+)
+
+// EmailIndex returns the blind index of an email address, ignoring case and surrounding spaces.
+func EmailIndex(email string) (string, error) {
+	return fieldcrypt.BlindIndex(userEmailColumn, strings.ToLower(strings.TrimSpace(email)))
+}
+
+// PhoneIndex returns the blind index of a phone number, ignoring everything but digits and a leading +.
+func PhoneIndex(phone string) (string, error) {
+	phone = strings.TrimSpace(phone)
+	var canonical strings.Builder
+	for i, r := range phone {
+		if (r >= '0' && r <= '9') || (r == '+' && i == 0) {
+			canonical.WriteRune(r)
+		}
+	}
+	return fieldcrypt.BlindIndex(userPhoneColumn, canonical.String())
+}
+
+// BeforeSave keeps the blind indexes in step with the email and phone number of u.
+// The columns themselves are encrypted by their serializer.
+func (u *User) BeforeSave(tx *gorm.DB) (err error) {
+	if u.EmailIndex, err = EmailIndex(u.Email); err != nil {
+		return err
+	}
+	u.PhoneIndex, err = PhoneIndex(u.Phone_number)
+	return err
+}
+
+// encryptUserColumns encrypts the personal columns in a map of updates and sets their blind
+// indexes. Updates with a map bypass the serializers, so every map update of users goes through it.
+func encryptUserColumns(fields map[string]interface{}) error {
+	columns := []struct {
+		name, associatedData, index string
+		blindIndex                  func(string) (string, error)
+	}{
+		{"email", userEmailColumn, "email_index", EmailIndex},
+		{"phone_number", userPhoneColumn, "phone_index", PhoneIndex},
+		{"date_of_birth", userBirthColumn, "", nil},
+	}
+	for _, column := range columns {
+		value, ok := fields[column.name].(string)
+		if !ok {
+			continue
+		}
+		if column.blindIndex != nil {
+			index, err := column.blindIndex(value)
+			if err != nil {
+				return err
+			}
+			fields[column.index] = index
+		}
+		encrypted, err := fieldcrypt.Encrypt(column.associatedData, value)
+		if err != nil {
+			return err
+		}
+		fields[column.name] = encrypted
+	}
+	return nil
+}
+
 // GetAllUsers Fetch all User data
 func GetAllUsers(db *gorm.DB, users *[]User) (err error) {
 	if err := db.Raw("SELECT * FROM users").Scan(users).Error; err != nil {
@@ -41,14 +179,323 @@ func GetUserByID(db *gorm.DB, users *User, username string) error { // Use param
 	return nil
 }
 
-func UpdateUser(db *gorm.DB, user *User) (err error) { // Update user (Assuming user.Username is the primary key)
-	// ทำการบันทึกข้อมูลผู้ใช้
-	if err := db.Save(user).Error; err != nil {
+// GetUsersByEmail fetches every user with an email address, ignoring case, through its blind index.
+// Email addresses are not unique, so several accounts may share one; none is an empty slice.
+func GetUsersByEmail(db *gorm.DB, email string) ([]User, error) {
+	users := []User{}
+	index, err := EmailIndex(email)
+	if err != nil || index == "" {
+		return users, err
+	}
+	err = db.Where("email_index = ?", index).Order("username").Find(&users).Error
+	return users, err
+}
+
+// GetUserByPhone fetches one user by phone number through its blind index
+func GetUserByPhone(db *gorm.DB, user *User, phone string) error {
+	index, err := PhoneIndex(phone)
+	if err != nil {
+		return err
+	}
+	if index == "" {
+		return gorm.ErrRecordNotFound
+	}
+	return db.Where("phone_index = ?", index).First(user).Error
+}
+
+// UpdateUserPassword replaces only the password hash of a user
+func UpdateUserPassword(db *gorm.DB, username string, hashedPassword string) error {
+	result := db.Model(&User{}).Where("username = ?", username).Update("password", hashedPassword)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// MarkEmailVerified flags the user's email as verified, provided it is still email.
+// It returns gorm.ErrRecordNotFound when the user does not exist or has changed their email since.
+func MarkEmailVerified(db *gorm.DB, username string, email string) error {
+	index, err := EmailIndex(email)
+	if err != nil {
+		return err
+	}
+	result := db.Model(&User{}).
+		Where("username = ? AND email_index = ?", username, index).
+		Updates(map[string]interface{}{"email_verified": true, "email_verified_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// UpdateUserFields updates only the given columns of username.
+// It returns gorm.ErrRecordNotFound for an unknown user and ErrUserErased for an erased one.
+func UpdateUserFields(db *gorm.DB, username string, fields map[string]interface{}) error {
+	// Encrypt a copy, so the caller's map keeps the plaintext
+	updates := make(map[string]interface{}, len(fields)+2)
+	for column, value := range fields {
+		updates[column] = value
+	}
+	if err := encryptUserColumns(updates); err != nil {
+		return err
+	}
+	result := db.Model(&User{}).Where("username = ? AND status <> ?", username, UserStatusErased).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return erasedOrNotFound(db, username)
+	}
+	return nil
+}
+
+// DeleteUser deletes username in one transaction, together with the rows keyed by the username
+// (notifications, sessions, reset tokens, two-factor secrets and dismissals), so that whoever
+// registers the username next does not inherit them. Orders are kept for accounting, moved to
+// pseudonym as EraseUser does; audit records are kept as they are.
+// It returns gorm.ErrRecordNotFound for an unknown user and ErrUserErased for an erased one,
+// whose orders must keep their account.
+func DeleteUser(db *gorm.DB, username, pseudonym string) (err error) { // Delete user (Assuming username is the primary key)
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("username = ? AND status <> ?", username, UserStatusErased).Delete(&User{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return erasedOrNotFound(tx, username)
+		}
+		if err := tx.Model(&Order{}).Where("username = ?", username).Update("username", pseudonym).Error; err != nil {
+			return err
+		}
+
+		deletes := []interface{}{
+			&Notification{},
+			&RefreshToken{},
+			&PasswordResetToken{},
+			&TwoFactorSecret{},
+			&RecoveryCode{},
+			&AnnouncementDismissal{},
+		}
+		for _, model := range deletes {
+			if err := tx.Where("username = ?", username).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListUsers returns one page of users matching query and the total number of matches.
+func ListUsers(db *gorm.DB, query UserListQuery) ([]User, int64, error) {
+	tx := db.Model(&User{})
+	if query.Search != "" {
+		pattern := "%" + escapeLike(query.Search) + "%"
+		emailIndex, err := EmailIndex(query.Search)
+		if err != nil {
+			return nil, 0, err
+		}
+		phoneIndex, err := PhoneIndex(query.Search)
+		if err != nil {
+			return nil, 0, err
+		}
+		tx = tx.Where("username ILIKE ? OR first_name ILIKE ? OR last_name ILIKE ? OR email_index = ? OR phone_index = ?",
+			pattern, pattern, pattern, emailIndex, phoneIndex)
+	}
+	if query.Role != "" {
+		tx = tx.Where("role = ?", query.Role)
+	}
+	if query.Status != "" {
+		tx = tx.Where("status = ?", query.Status)
+	}
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	sort := "username"
+	if IsValidUserSort(query.Sort) {
+		sort = query.Sort
+	}
+	direction := "ASC"
+	if query.Desc {
+		direction = "DESC"
+	}
+	var users []User
+	err := tx.Order(sort + " " + direction).Order("username ASC").
+		Limit(query.Limit).Offset(query.Offset).Find(&users).Error
+	return users, total, err
+}
+
+// escapeLike escapes the LIKE wildcards in a user-supplied search term.
+func escapeLike(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(value)
+}
+
+// SetUserStatus suspends or reactivates username. It returns gorm.ErrRecordNotFound for an unknown user
+// and ErrUserErased for an erased one.
+func SetUserStatus(db *gorm.DB, username string, status string, reason string) error {
+	updates := map[string]interface{}{"status": status, "suspended_at": nil, "suspended_reason": ""}
+	if status == UserStatusSuspended {
+		updates["suspended_at"] = time.Now()
+		updates["suspended_reason"] = reason
+	}
+	result := db.Model(&User{}).Where("username = ? AND status <> ?", username, UserStatusErased).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return erasedOrNotFound(db, username)
+	}
+	return nil
+}
+
+// erasedOrNotFound explains why a change of username, made only to accounts that are not erased,
+// matched no row: ErrUserErased if the account exists, gorm.ErrRecordNotFound if it does not.
+func erasedOrNotFound(db *gorm.DB, username string) error {
+	var count int64
+	if err := db.Model(&User{}).Where("username = ?", username).Count(&count).Error; err != nil {
 		return err
 	}
+	if count > 0 {
+		return ErrUserErased
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// GetSuspendedUsernames returns the usernames of every suspended account.
+func GetSuspendedUsernames(db *gorm.DB) ([]string, error) {
+	var usernames []string
+	err := db.Model(&User{}).Where("status = ?", UserStatusSuspended).Pluck("username", &usernames).Error
+	return usernames, err
+}
+
+// SetUserRole changes the role of username. It returns gorm.ErrRecordNotFound for an unknown user
+// and ErrUserErased for an erased one.
+func SetUserRole(db *gorm.DB, username string, role string) error {
+	result := db.Model(&User{}).Where("username = ? AND status <> ?", username, UserStatusErased).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return erasedOrNotFound(db, username)
+	}
 	return nil
 }
 
-func DeleteUser(db *gorm.DB, username string) (err error) { // Delete user (Assuming username is the primary key)
-	return db.Where("username = ?", username).Delete(&User{}).Error
+// ReencryptStats reports what ReencryptUsers did.
+type ReencryptStats struct {
+	Scanned int // users read
+	Updated int // users whose columns or blind indexes were rewritten (or would be, in a dry run)
+	Skipped int // users changed by someone else meanwhile; they were saved with the active key anyway
+}
+
+// storedUserColumns is the personal data of a users row as stored, read without the serializers.
+type storedUserColumns struct {
+	Username    string
+	Email       string
+	PhoneNumber string
+	DateOfBirth string
+	EmailIndex  string
+	PhoneIndex  string
+}
+
+// ReencryptUsers rewrites, batchSize users at a time, every personal column that is plaintext
+// or encrypted with a key other than the active one, and recomputes the blind indexes. Run it
+// after activating a new key (or a new BLIND_INDEX_KEY), then retire the old key.
+// A row is only rewritten if it has not changed since it was read.
+func ReencryptUsers(db *gorm.DB, batchSize int, dryRun bool) (ReencryptStats, error) {
+	var stats ReencryptStats
+	active, err := fieldcrypt.ActiveKeyID()
+	if err != nil {
+		return stats, err
+	}
+
+	last := ""
+	for {
+		var rows []storedUserColumns
+		err := db.Table("users").
+			Select("username, COALESCE(email, '') AS email, COALESCE(phone_number, '') AS phone_number, "+
+				"COALESCE(date_of_birth, '') AS date_of_birth, COALESCE(email_index, '') AS email_index, COALESCE(phone_index, '') AS phone_index").
+			Where("username > ?", last).Order("username").Limit(batchSize).Scan(&rows).Error
+		if err != nil {
+			return stats, err
+		}
+		if len(rows) == 0 {
+			return stats, nil
+		}
+
+		for _, row := range rows {
+			stats.Scanned++
+			last = row.Username
+			fields, err := reencryptedUserColumns(row, active)
+			if err != nil {
+				return stats, fmt.Errorf("user %s: %w", row.Username, err)
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			if dryRun {
+				stats.Updated++
+				continue
+			}
+			result := db.Table("users").
+				Where("username = ? AND COALESCE(email, '') = ? AND COALESCE(phone_number, '') = ? AND COALESCE(date_of_birth, '') = ?",
+					row.Username, row.Email, row.PhoneNumber, row.DateOfBirth).
+				UpdateColumns(fields)
+			if result.Error != nil {
+				return stats, fmt.Errorf("user %s: %w", row.Username, result.Error)
+			}
+			if result.RowsAffected == 0 {
+				stats.Skipped++
+			} else {
+				stats.Updated++
+			}
+		}
+	}
+}
+
+// reencryptedUserColumns returns the column updates that bring row to the active key and
+// current blind indexes, or nothing when it is up to date.
+func reencryptedUserColumns(row storedUserColumns, active string) (map[string]interface{}, error) {
+	plaintext := make(map[string]interface{}, 3)
+	stale := false
+	for _, column := range []struct {
+		name, associatedData, value string
+	}{
+		{"email", userEmailColumn, row.Email},
+		{"phone_number", userPhoneColumn, row.PhoneNumber},
+		{"date_of_birth", userBirthColumn, row.DateOfBirth},
+	} {
+		value, err := fieldcrypt.Decrypt(column.associatedData, column.value)
+		if err != nil {
+			return nil, err
+		}
+		plaintext[column.name] = value
+		if column.value != "" && fieldcrypt.KeyID(column.value) != active {
+			stale = true
+		}
+	}
+
+	fields := map[string]interface{}{}
+	for key, value := range plaintext {
+		fields[key] = value
+	}
+	if err := encryptUserColumns(fields); err != nil {
+		return nil, err
+	}
+	if !stale && fields["email_index"] == row.EmailIndex && fields["phone_index"] == row.PhoneIndex {
+		return nil, nil
+	}
+	if !stale {
+		// Only the indexes are out of date; keep the ciphertexts
+		return map[string]interface{}{"email_index": fields["email_index"], "phone_index": fields["phone_index"]}, nil
+	}
+	return fields, nil
 }
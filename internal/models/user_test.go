@@ -0,0 +1,101 @@
+package models
+
+import (
+	"testing"
+
+	"order-notification-system/internal/fieldcrypt"
+)
+
+// initTestKeys loads field encryption keys old and new, with active encrypting, and a blind index key.
+func initTestKeys(t *testing.T, active, oldKey, newKey, indexKey string) {
+	t.Helper()
+	t.Setenv("FIELD_ENCRYPTION_KEYS", "old:"+oldKey+",new:"+newKey)
+	t.Setenv("FIELD_ENCRYPTION_ACTIVE_KEY", active)
+	t.Setenv("BLIND_INDEX_KEY", indexKey)
+	if err := fieldcrypt.Init(); err != nil {
+		t.Fatalf("fieldcrypt.Init: %v", err)
+	}
+}
+
+func newTestKey(t *testing.T) string {
+	t.Helper()
+	key, err := fieldcrypt.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// storedUser returns the stored columns of a user whose values are encrypted with the active key.
+func storedUser(t *testing.T, email, phone, birth string) storedUserColumns {
+	t.Helper()
+	fields := map[string]interface{}{"email": email, "phone_number": phone, "date_of_birth": birth}
+	if err := encryptUserColumns(fields); err != nil {
+		t.Fatalf("encryptUserColumns: %v", err)
+	}
+	return storedUserColumns{
+		Username:    "somchai",
+		Email:       fields["email"].(string),
+		PhoneNumber: fields["phone_number"].(string),
+		DateOfBirth: fields["date_of_birth"].(string),
+		EmailIndex:  fields["email_index"].(string),
+		PhoneIndex:  fields["phone_index"].(string),
+	}
+}
+
+func TestReencryptedUserColumns(t *testing.T) {
+	oldKey, newKey, indexKey := newTestKey(t), newTestKey(t), newTestKey(t)
+
+	initTestKeys(t, "old", oldKey, newKey, indexKey)
+	underOld := storedUser(t, "somchai@example.com", "081-234-5678", "1990-01-01")
+
+	initTestKeys(t, "new", oldKey, newKey, indexKey)
+	current := storedUser(t, "somchai@example.com", "081-234-5678", "1990-01-01")
+	staleIndex := current
+	staleIndex.EmailIndex = "outdated"
+	emailIndex, err := EmailIndex("somchai@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		row  storedUserColumns
+		// wantColumns are the columns that must be rewritten; nil means none
+		wantColumns []string
+	}{
+		{"up to date", current, nil},
+		{"encrypted with old key", underOld, []string{"email", "phone_number", "date_of_birth", "email_index", "phone_index"}},
+		{"plaintext", storedUserColumns{Username: "somchai", Email: "somchai@example.com", PhoneNumber: "0812345678"},
+			[]string{"email", "phone_number", "date_of_birth", "email_index", "phone_index"}},
+		{"stale blind index", staleIndex, []string{"email_index", "phone_index"}},
+		{"empty row", storedUserColumns{Username: "somchai"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := reencryptedUserColumns(tt.row, "new")
+			if err != nil {
+				t.Fatalf("reencryptedUserColumns: %v", err)
+			}
+			if len(fields) != len(tt.wantColumns) {
+				t.Fatalf("rewrites %v, want %v", fields, tt.wantColumns)
+			}
+			for _, column := range tt.wantColumns {
+				if _, ok := fields[column]; !ok {
+					t.Errorf("column %s is not rewritten", column)
+				}
+			}
+			if email, ok := fields["email"].(string); ok {
+				if fieldcrypt.KeyID(email) != "new" {
+					t.Errorf("email is encrypted with %q, want new", fieldcrypt.KeyID(email))
+				}
+				if plaintext, err := fieldcrypt.Decrypt(userEmailColumn, email); err != nil || plaintext != "somchai@example.com" {
+					t.Errorf("email decrypts to (%q, %v)", plaintext, err)
+				}
+			}
+			if index, ok := fields["email_index"]; ok && index != emailIndex {
+				t.Errorf("email_index = %v, want %s", index, emailIndex)
+			}
+		})
+	}
+}
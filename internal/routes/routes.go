@@ -1,8 +1,14 @@
 package routes
 
 import (
+	"time"
+
 	"order-notification-system/internal/api"
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/auth"
+	"order-notification-system/internal/config"
 	"order-notification-system/internal/handlers"
+	"order-notification-system/internal/mail"
 	"order-notification-system/internal/middleware"
 	"order-notification-system/internal/websocket"
 
@@ -22,9 +28,24 @@ func SetupRouter(r *gin.Engine, db *gorm.DB) {
 	// we can also initialize them here if they only depend on `db`.
 
 	orderAPIHandler := api.NewOrderAPI(db)
-	userHandler := handlers.NewUserHandler(db)
-	authHandler := handlers.NewAuthHandler(db)
+	mailer := mail.NewSenderFromEnv()
+	userHandler := handlers.NewUserHandler(db, mailer, auth.NewLoginThrottle(auth.LoadVerificationThrottleConfig()))
+	wsTickets := auth.NewTicketStore(config.GetEnvDuration("WS_TICKET_TTL", 30*time.Second))
+	loginThrottle := auth.NewLoginThrottle(auth.LoadThrottleConfig())
+	mfaChallenges := auth.NewMFAChallengeStore(config.GetEnvDuration("MFA_CHALLENGE_TTL", 5*time.Minute))
+	authHandler := handlers.NewAuthHandler(db, wsTickets, loginThrottle, mfaChallenges)
 	profileHandler := handlers.NewProfileHandler(db)
+	passwordHandler := handlers.NewPasswordHandler(db, mailer, loginThrottle, auth.NewLoginThrottle(auth.LoadResetThrottleConfig()))
+	notificationHandler := handlers.NewNotificationHandler(db)
+	announcementHandler := handlers.NewAnnouncementHandler(db)
+	apiKeyHandler := handlers.NewAPIKeyHandler(db)
+	privacyHandler := handlers.NewPrivacyHandler(db, loginThrottle)
+	wsHandler := websocket.NewHandler(db, websocket.LoadConfig())
+
+	// Unknown paths get the same problem+json errors as the API
+	r.NoRoute(func(c *gin.Context) {
+		apierror.Respond(c, apierror.ErrNotFound.WithDetail("No route matches %s %s", c.Request.Method, c.Request.URL.Path))
+	})
 
 	// Public routes
 	// Grouping public routes under /api prefix
@@ -32,29 +53,91 @@ func SetupRouter(r *gin.Engine, db *gorm.DB) {
 	{
 		publicAPIRoutes.GET("/", userHandler.GetRemark)
 		publicAPIRoutes.POST("/users", userHandler.CreateUser)
+		publicAPIRoutes.GET("/email/verify", userHandler.VerifyEmail)
 		publicAPIRoutes.POST("/login", authHandler.Login)
+		publicAPIRoutes.POST("/login/2fa", authHandler.LoginWithSecondFactor)
+		publicAPIRoutes.POST("/login/2fa/enroll", authHandler.StartLoginEnrollment)
+		publicAPIRoutes.POST("/login/2fa/confirm", authHandler.ConfirmLoginEnrollment)
+		publicAPIRoutes.POST("/token/refresh", authHandler.Refresh)
+		publicAPIRoutes.POST("/password/forgot", passwordHandler.ForgotPassword)
+		publicAPIRoutes.POST("/password/reset", passwordHandler.ResetPassword)
 	}
+	// Public signing keys for services that verify our tokens
+	r.GET("/.well-known/jwks.json", handlers.GetJWKS)
+
 	// Order related public route
-	r.POST("/order", orderAPIHandler.CreateOrder)
+	r.POST("/order", middleware.OptionalJWTMiddleware(), middleware.RequireVerifiedEmail(db), orderAPIHandler.CreateOrder)
 	r.GET("/products", orderAPIHandler.GetProducts)
 	// Protected routes
 	// Grouping protected routes under /api prefix and applying JWT middleware
 	protectedAPIRoutes := r.Group("/api")
 	protectedAPIRoutes.Use(middleware.JWTMiddleware())
 	{
-		// protectedAPIRoutes.GET("/users", userHandler.GetUsersAll) // Assuming GetUsersAll exists
-		protectedAPIRoutes.GET("/users/:username", userHandler.GetUserByID)
-		protectedAPIRoutes.PUT("/users/:username", userHandler.UpdateUser)
-		protectedAPIRoutes.DELETE("/users/:username", userHandler.DeleteUser)
+		// User administration (requires users:manage)
+		manageUsers := middleware.RequirePermission(auth.PermManageUsers)
+		protectedAPIRoutes.GET("/users", manageUsers, userHandler.ListUsers)
+		protectedAPIRoutes.POST("/users/:username/suspend", manageUsers, userHandler.SuspendUser)
+		protectedAPIRoutes.POST("/users/:username/reactivate", manageUsers, userHandler.ReactivateUser)
+		protectedAPIRoutes.PUT("/users/:username/role", manageUsers, userHandler.ChangeUserRole)
+		// User routes: only the user themselves or users:manage; other callers get 403 and a security event
+		selfOrAdmin := middleware.RequireSelfOrPermission(auth.PermManageUsers)
+		protectedAPIRoutes.GET("/users/:username", selfOrAdmin, userHandler.GetUserByID)
+		protectedAPIRoutes.PATCH("/users/:username", selfOrAdmin, userHandler.UpdateUser)
+		protectedAPIRoutes.PUT("/users/:username", selfOrAdmin, userHandler.UpdateUser) // Deprecated: same partial update as PATCH
+		protectedAPIRoutes.DELETE("/users/:username", selfOrAdmin, userHandler.DeleteUser)
+		// Privacy requests (PDPA): users export or erase their own data; users:manage can act for them
+		protectedAPIRoutes.GET("/users/:username/export", selfOrAdmin, privacyHandler.ExportUserData)
+		protectedAPIRoutes.POST("/users/:username/erase", selfOrAdmin, privacyHandler.EraseUser)
+		protectedAPIRoutes.GET("/privacy-requests", manageUsers, privacyHandler.ListPrivacyRequests)
+		protectedAPIRoutes.PUT("/users/:username/password", selfOrAdmin, passwordHandler.ChangePassword)
+		protectedAPIRoutes.DELETE("/users/:username/sessions", middleware.RequirePermission(auth.PermManageUsers), authHandler.RevokeUserSessions)
+		protectedAPIRoutes.POST("/users/:username/unlock", middleware.RequirePermission(auth.PermManageUsers), authHandler.UnlockAccount)
+		protectedAPIRoutes.POST("/users/:username/verify-email", middleware.RequirePermission(auth.PermManageUsers), userHandler.AdminVerifyEmail)
+		protectedAPIRoutes.DELETE("/users/:username/2fa", middleware.RequirePermission(auth.PermManageUsers), authHandler.ResetTwoFactor)
+		protectedAPIRoutes.POST("/email/verification/resend", userHandler.ResendVerification)
+		protectedAPIRoutes.GET("/2fa", authHandler.GetTwoFactorStatus)
+		protectedAPIRoutes.POST("/2fa/enroll", authHandler.StartTwoFactorEnrollment)
+		protectedAPIRoutes.POST("/2fa/confirm", authHandler.ConfirmTwoFactorEnrollment)
+		protectedAPIRoutes.POST("/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+		protectedAPIRoutes.DELETE("/2fa", authHandler.DisableTwoFactor)
+		protectedAPIRoutes.POST("/logout", authHandler.Logout)
+		protectedAPIRoutes.POST("/logout/all", authHandler.LogoutAll)
 		protectedAPIRoutes.GET("/profile", profileHandler.GetProfile)
+		protectedAPIRoutes.POST("/ws/ticket", authHandler.IssueWebSocketTicket)
+		protectedAPIRoutes.GET("/ws/stats", middleware.RequirePermission(auth.PermViewSystemStats), wsHandler.Stats)
+
+		// Notification inbox routes (protected)
+		protectedAPIRoutes.GET("/notifications", notificationHandler.ListNotifications)
+		protectedAPIRoutes.GET("/notifications/unread-count", notificationHandler.GetUnreadCount)
+		protectedAPIRoutes.POST("/notifications/read", notificationHandler.BulkMarkRead)
+		protectedAPIRoutes.PUT("/notifications/:id/read", notificationHandler.MarkRead)
+		protectedAPIRoutes.DELETE("/notifications/:id/read", notificationHandler.MarkUnread)
+
+		// Announcement routes (protected; publishing requires announcements:publish)
+		protectedAPIRoutes.GET("/announcements", announcementHandler.ListAnnouncements)
+		protectedAPIRoutes.POST("/announcements", middleware.RequirePermission(auth.PermPublishAnnouncements), announcementHandler.CreateAnnouncement)
+		protectedAPIRoutes.POST("/announcements/:id/dismiss", announcementHandler.DismissAnnouncement)
+
+		// API key management (requires apikeys:manage)
+		protectedAPIRoutes.GET("/apikeys", middleware.RequirePermission(auth.PermManageAPIKeys), apiKeyHandler.ListAPIKeys)
+		protectedAPIRoutes.POST("/apikeys", middleware.RequirePermission(auth.PermManageAPIKeys), apiKeyHandler.CreateAPIKey)
+		protectedAPIRoutes.DELETE("/apikeys/:id", middleware.RequirePermission(auth.PermManageAPIKeys), apiKeyHandler.RevokeAPIKey)
 
 		// Product routes (protected)
 		// protectedAPIRoutes.GET("/products", orderAPIHandler.GetProducts)       // New route for getting all products
-		protectedAPIRoutes.POST("/getproduct", orderAPIHandler.GetProduct)     // Existing route, kept for consistency if needed, but GET /products/:id is more RESTful
-		protectedAPIRoutes.POST("/editproduct", orderAPIHandler.CreateProduct) // Existing route, consider changing to POST /products for creation
+		protectedAPIRoutes.POST("/getproduct", orderAPIHandler.GetProduct) // Existing route, kept for consistency if needed, but GET /products/:id is more RESTful
+	}
+
+	// Product management routes (managers and admins)
+	productAdminRoutes := r.Group("/api")
+	productAdminRoutes.Use(middleware.JWTMiddleware(), middleware.RequirePermission(auth.PermManageProducts))
+	{
+		productAdminRoutes.POST("/editproduct", orderAPIHandler.CreateProduct) // Existing route, consider changing to POST /products for creation
+		productAdminRoutes.PUT("/products/:id/translations/:lang", orderAPIHandler.SaveProductTranslation)
+		productAdminRoutes.DELETE("/products/:id/translations/:lang", orderAPIHandler.DeleteProductTranslation)
 	}
 
 	// WebSocket and Order Status routes (protected)
-	r.GET("/ws", middleware.JWTMiddleware(), gin.WrapF(websocket.HandleWebSocket))
-	r.PATCH("/orders/:id/status", middleware.JWTMiddleware(), orderAPIHandler.UpdateOrderStatus)
+	r.GET("/ws", middleware.WebSocketAuthMiddleware(wsTickets, wsHandler.CheckOrigin), wsHandler.HandleWebSocket)
+	r.PATCH("/orders/:id/status", middleware.JWTMiddleware(), middleware.RequirePermission(auth.PermUpdateOrders), orderAPIHandler.UpdateOrderStatus)
 }
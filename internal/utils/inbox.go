@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"errors"
+	"log"
+
+	"order-notification-system/internal/i18n"
+	"order-notification-system/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// DeliverNotification stores a notification in the user's inbox and pushes it,
+// together with the new unread count, to any connections the user has open.
+// Users who are offline see it the next time they list their notifications.
+func DeliverNotification(db *gorm.DB, notification *models.Notification) error {
+	if err := models.CreateNotification(db, notification); err != nil {
+		return err
+	}
+	NotifyUser(notification.Username, map[string]interface{}{
+		"type":         "notification",
+		"notification": notification,
+	})
+	PushUnreadCount(db, notification.Username)
+	return nil
+}
+
+// DeliverAnnouncementToInboxes records an announcement in the inbox of each active user in its
+// audience and pushes the new unread count to those connected. Station announcements go to
+// screens only and are not recorded.
+func DeliverAnnouncementToInboxes(db *gorm.DB, announcement *models.Announcement) {
+	written, err := models.CreateAnnouncementNotifications(db, announcement)
+	if err != nil {
+		log.Printf("Error recording announcement %d in inboxes: %v", announcement.ID, err)
+		return
+	}
+	if written == 0 {
+		return
+	}
+	for _, username := range ConnectedUsernames(func(client *Client) bool { return announcement.Matches("", client.Role) }) {
+		PushUnreadCount(db, username)
+	}
+}
+
+// PushUnreadCount sends the user's current unread notification count to their open connections.
+func PushUnreadCount(db *gorm.DB, username string) {
+	count, err := models.CountUnreadNotifications(db, username)
+	if err != nil {
+		log.Printf("Error counting unread notifications for '%s': %v", username, err)
+		return
+	}
+	NotifyUser(username, UnreadCountMessage(count))
+}
+
+// UnreadCountMessage builds the unread_count frame.
+func UnreadCountMessage(count int64) map[string]interface{} {
+	return map[string]interface{}{
+		"type":  "unread_count",
+		"count": count,
+	}
+}
+
+// NotifyOrderOwner records an inbox notification for the customer who placed the order
+// when it becomes ready or is cancelled, in the customer's preferred language.
+// Orders placed anonymously or by erased accounts are skipped.
+func NotifyOrderOwner(db *gorm.DB, order *models.Order, previousStatus string) {
+	if order.Username == "" || order.Status == previousStatus {
+		return
+	}
+
+	var owner models.User
+	if err := models.GetUserByID(db, &owner, order.Username); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return // the account was deleted
+		}
+		log.Printf("Error loading the owner '%s' of order %d: %v", order.Username, order.ID, err)
+		return
+	}
+	if owner.IsErased() {
+		return
+	}
+	language := owner.Language
+	if !i18n.IsSupported(language) {
+		language = i18n.Default()
+	}
+
+	notification := &models.Notification{
+		Username: order.Username,
+		OrderID:  &order.ID,
+	}
+	switch order.Status {
+	case models.OrderStatusReady:
+		notification.Type = models.NotificationOrderReady
+		notification.Title = i18n.Translate(language, "Your order is ready")
+		notification.Message = i18n.Translate(language, "Order #%d (%d x %s) is ready for pickup.", order.ID, order.Quantity, order.Item)
+	case models.OrderStatusCancelled:
+		notification.Type = models.NotificationOrderCancelled
+		notification.Title = i18n.Translate(language, "Your order was cancelled")
+		notification.Message = i18n.Translate(language, "Order #%d (%d x %s) has been cancelled.", order.ID, order.Quantity, order.Item)
+	default:
+		return
+	}
+
+	if err := DeliverNotification(db, notification); err != nil {
+		log.Printf("Error storing notification for order %d: %v", order.ID, err)
+	}
+}
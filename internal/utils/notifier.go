@@ -1,47 +1,298 @@
 package utils
 
 import (
+	"errors"
+	"log"
 	"sync"
 
+	"order-notification-system/internal/models"
+
 	"github.com/gorilla/websocket"
 )
 
+// clientSendBuffer is how many messages may queue for a client before it is considered too slow and dropped.
+const clientSendBuffer = 64
+
+// Subscription selects which order events a client receives.
+type Subscription struct {
+	// Statuses lists the order statuses the client displays.
+	Statuses []string `json:"statuses"`
+	// Station is the kitchen station the screen belongs to (e.g. "grill"), used to target announcements.
+	Station string `json:"station,omitempty"`
+}
+
+func (s Subscription) matches(status string) bool {
+	for _, wanted := range s.Statuses {
+		if wanted == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Client is a connected WebSocket client. Messages are queued and written by WritePump,
+// so broadcasts never block on a slow connection and writes are never concurrent.
+type Client struct {
+	Conn     *websocket.Conn
+	Username string
+	// Role is the user's role, used to target announcements
+	Role string
+
+	send         chan interface{}
+	subscription Subscription
+	closed       bool // set once send is closed; guarded by clientsMu
+	// While a snapshot loads, messages are held in held and sent after it; guarded by clientsMu
+	loadingSnapshot bool
+	held            []interface{}
+}
+
+// NewClient wraps an authenticated connection.
+func NewClient(conn *websocket.Conn, username string, role string) *Client {
+	return &Client{
+		Conn:     conn,
+		Username: username,
+		Role:     role,
+		send:     make(chan interface{}, clientSendBuffer),
+	}
+}
+
+// WritePump writes queued messages until the client is unregistered or a write fails.
+func (c *Client) WritePump() {
+	for message := range c.send {
+		if err := c.Conn.WriteJSON(message); err != nil {
+			c.Conn.Close()
+			// Keep draining so enqueue never blocks; the read loop will unregister us
+			for range c.send {
+			}
+			return
+		}
+	}
+}
+
+// Snapshot is the first message a client receives after subscribing.
+// Seq is the sequence number of the last event already reflected in Orders;
+// the client applies only events with a larger seq, keyed by order ID, and
+// ignores an event whose order version is lower than the one it holds.
+type Snapshot struct {
+	Type   string         `json:"type"`
+	Seq    uint64         `json:"seq"`
+	Orders []models.Order `json:"orders"`
+}
+
+var errClientClosed = errors.New("client is disconnected")
+
 var (
-	clients   = make(map[*websocket.Conn]bool)
+	clients   = make(map[*Client]bool)
 	clientsMu sync.Mutex
+	// lastSeq numbers every broadcast event; guarded by clientsMu
+	lastSeq uint64
 )
 
-// NotifyNewOrder broadcasts a new order notification to all connected WebSocket clients.
-func NotifyNewOrder(orderID string, itemCode string, item string, quantity int) {
+// enqueueLocked queues message for client, dropping the client if its buffer is full.
+// While the client's snapshot loads, the message is held until the snapshot is queued.
+// clientsMu must be held.
+func enqueueLocked(client *Client, message interface{}) {
+	if client.loadingSnapshot {
+		if len(client.held) < clientSendBuffer {
+			client.held = append(client.held, message)
+			return
+		}
+		log.Printf("WebSocket client '%s' missed too many events while loading its snapshot, disconnecting", client.Username)
+		removeLocked(client)
+		client.Conn.Close()
+		return
+	}
+	select {
+	case client.send <- message:
+	default:
+		log.Printf("WebSocket client '%s' is too slow, disconnecting", client.Username)
+		removeLocked(client)
+		client.Conn.Close()
+	}
+}
+
+func removeLocked(client *Client) {
+	delete(clients, client)
+	if !client.closed {
+		client.closed = true
+		close(client.send)
+	}
+}
+
+// NotifyNewOrder broadcasts a new order notification to all subscribed WebSocket clients.
+func NotifyNewOrder(order *models.Order) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	lastSeq++
+	message := map[string]interface{}{
+		"type":     "order_created",
+		"seq":      lastSeq,
+		"order":    order,
+		"orderID":  order.ID,
+		"itemCode": order.ItemCode,
+		"item":     order.Item,
+		"quantity": order.Quantity,
+	}
+
+	for client := range clients {
+		if client.subscription.matches(order.Status) {
+			enqueueLocked(client, message)
+		}
+	}
+}
+
+// NotifyOrderStatus broadcasts a status change to clients subscribed to either the new or the previous status,
+// so an order leaving a client's view is removed there as well.
+func NotifyOrderStatus(order *models.Order, previousStatus string) {
 	clientsMu.Lock()
 	defer clientsMu.Unlock()
 
+	lastSeq++
 	message := map[string]interface{}{
-		"orderID":  orderID,
-		"itemCode": itemCode,
-		"item":     item,
-		"quantity": quantity,
+		"type":            "order_status",
+		"seq":             lastSeq,
+		"order":           order,
+		"previous_status": previousStatus,
+	}
+
+	for client := range clients {
+		if client.subscription.matches(order.Status) || client.subscription.matches(previousStatus) {
+			enqueueLocked(client, message)
+		}
+	}
+}
+
+// NotifyUser queues a message for every connection of one user, regardless of subscription.
+func NotifyUser(username string, message interface{}) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	for client := range clients {
+		if client.Username == username {
+			enqueueLocked(client, message)
+		}
 	}
+}
 
+// NotifyAnnouncement pushes an announcement to every connected client in its audience.
+func NotifyAnnouncement(announcement *models.Announcement) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	message := AnnouncementsMessage([]models.Announcement{*announcement})
 	for client := range clients {
-		err := client.WriteJSON(message)
-		if err != nil {
-			client.Close()
-			delete(clients, client)
+		if announcement.Matches(client.subscription.Station, client.Role) {
+			enqueueLocked(client, message)
 		}
 	}
 }
 
-// RegisterClient adds a new WebSocket client to the list of connected clients.
-func RegisterClient(client *websocket.Conn) {
+// AnnouncementsMessage builds the announcements frame.
+func AnnouncementsMessage(announcements []models.Announcement) map[string]interface{} {
+	return map[string]interface{}{
+		"type":          "announcements",
+		"announcements": announcements,
+	}
+}
+
+// ActiveAnnouncementsFor filters announcements to those addressed to client.
+func ActiveAnnouncementsFor(client *Client, announcements []models.Announcement) []models.Announcement {
 	clientsMu.Lock()
+	station := client.subscription.Station
+	clientsMu.Unlock()
+
+	matching := []models.Announcement{}
+	for _, announcement := range announcements {
+		if announcement.Matches(station, client.Role) {
+			matching = append(matching, announcement)
+		}
+	}
+	return matching
+}
+
+// ConnectedUsernames returns the users with at least one open connection that matches.
+func ConnectedUsernames(matches func(*Client) bool) []string {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	seen := make(map[string]bool)
+	usernames := []string{}
+	for client := range clients {
+		if client.Username != "" && !seen[client.Username] && matches(client) {
+			seen[client.Username] = true
+			usernames = append(usernames, client.Username)
+		}
+	}
+	return usernames
+}
+
+// DisconnectUser closes every connection of a user, e.g. after their sessions are revoked.
+func DisconnectUser(username string) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	for client := range clients {
+		if client.Username == username {
+			removeLocked(client)
+			client.Conn.Close()
+		}
+	}
+}
+
+// Subscribe sets the client's subscription, queues a snapshot built by load and
+// registers the client for incremental events. load runs without the broadcast lock:
+// the client is registered first and events broadcast meanwhile are held, then sent
+// right after the snapshot. The snapshot's Seq is the last event before the load, so
+// held events have a larger seq; any already reflected in the snapshot carry an order
+// version the client holds already and are ignored by it.
+// Calling it again for a registered client replaces the subscription and sends a fresh snapshot.
+// If load fails, the new subscription stays in effect without a snapshot and held events are sent.
+func Subscribe(client *Client, subscription Subscription, load func(Subscription) ([]models.Order, error)) error {
+	clientsMu.Lock()
+	if client.closed {
+		clientsMu.Unlock()
+		return errClientClosed
+	}
 	clients[client] = true
+	client.subscription = subscription
+	client.loadingSnapshot = true
+	seq := lastSeq
 	clientsMu.Unlock()
+
+	orders, err := load(subscription)
+
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	held := client.held
+	client.loadingSnapshot, client.held = false, nil
+	if client.closed {
+		return errClientClosed
+	}
+	if err == nil {
+		enqueueLocked(client, Snapshot{Type: "snapshot", Seq: seq, Orders: orders})
+	}
+	for _, message := range held {
+		if client.closed {
+			break
+		}
+		enqueueLocked(client, message)
+	}
+	return err
 }
 
-// UnregisterClient removes a WebSocket client from the list of connected clients.
-func UnregisterClient(client *websocket.Conn) {
+// Send queues a message for a single client.
+func Send(client *Client, message interface{}) {
 	clientsMu.Lock()
-	delete(clients, client)
+	defer clientsMu.Unlock()
+	if clients[client] {
+		enqueueLocked(client, message)
+	}
+}
+
+// UnregisterClient removes a WebSocket client from the list of connected clients and stops its WritePump.
+func UnregisterClient(client *Client) {
+	clientsMu.Lock()
+	removeLocked(client)
 	clientsMu.Unlock()
 }
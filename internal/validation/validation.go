@@ -0,0 +1,265 @@
+// Package validation binds request bodies and turns validation failures into
+// field-level errors that clients can attach to form fields.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/i18n"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError describes one invalid field of a request.
+type FieldError struct {
+	// Field is the JSON path of the field, e.g. "email" or "items[0].quantity"
+	Field string `json:"field"`
+	// Rule is the broken rule, e.g. "required", "max" or "email"
+	Rule string `json:"rule"`
+	// Param is the rule's parameter, if any, e.g. "100" for max=100
+	Param string `json:"param,omitempty"`
+	// Message is English until Respond translates it; it is a format string for args
+	Message string `json:"message"`
+	args    []interface{}
+}
+
+// Rules added to the standard validator ones.
+var (
+	phonePattern    = regexp.MustCompile(`^\+?[0-9]{9,15}$`)
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,50}$`)
+)
+
+const dateLayout = "2006-01-02"
+
+var setupOnce sync.Once
+
+// setup registers the custom rules and makes errors report JSON field names.
+// It configures gin's default validator, so `binding` tags use the same rules.
+func setup() {
+	setupOnce.Do(func() {
+		v, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+		_ = v.RegisterValidation("language", func(fl validator.FieldLevel) bool {
+			return i18n.IsSupported(fl.Field().String())
+		})
+		_ = v.RegisterValidation("notblank", func(fl validator.FieldLevel) bool {
+			return strings.TrimSpace(fl.Field().String()) != ""
+		})
+		_ = v.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+			return phonePattern.MatchString(NormalizePhone(fl.Field().String()))
+		})
+		_ = v.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+			return usernamePattern.MatchString(fl.Field().String())
+		})
+		// date: a real calendar date in YYYY-MM-DD form
+		_ = v.RegisterValidation("date", func(fl validator.FieldLevel) bool {
+			_, err := time.Parse(dateLayout, strings.TrimSpace(fl.Field().String()))
+			return err == nil
+		})
+		// birthdate: a date between 1900-01-01 and today
+		_ = v.RegisterValidation("birthdate", func(fl validator.FieldLevel) bool {
+			date, err := time.Parse(dateLayout, strings.TrimSpace(fl.Field().String()))
+			return err == nil && date.Year() >= 1900 && !date.After(time.Now())
+		})
+	})
+}
+
+// NormalizePhone strips the separators people commonly type in phone numbers.
+func NormalizePhone(phone string) string {
+	return strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "").Replace(strings.TrimSpace(phone))
+}
+
+// Struct validates v against its `binding` tags and returns the invalid fields.
+func Struct(v interface{}) []FieldError {
+	setup()
+	if err := binding.Validator.ValidateStruct(v); err != nil {
+		return FromError(err)
+	}
+	return nil
+}
+
+// FromError converts a binding or validation error into field errors.
+func FromError(err error) []FieldError {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		fieldErrors := make([]FieldError, 0, len(validationErrors))
+		for _, fe := range validationErrors {
+			param := fe.Param()
+			if strings.HasPrefix(fe.Tag(), "required_") {
+				// The parameter names Go struct fields, which mean nothing to clients
+				param = ""
+			}
+			format, args := message(fe)
+			fieldErrors = append(fieldErrors, FieldError{
+				Field:   fieldPath(fe),
+				Rule:    fe.Tag(),
+				Param:   param,
+				Message: format,
+				args:    args,
+			})
+		}
+		return fieldErrors
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		typeName := jsonTypeName(typeError.Type)
+		return []FieldError{{
+			Field:   typeError.Field,
+			Rule:    "type",
+			Param:   typeName,
+			Message: "must be of type %s",
+			args:    []interface{}{typeName},
+		}}
+	}
+	return nil
+}
+
+// fieldPath returns the JSON path of the field without the name of the top-level struct.
+func fieldPath(fe validator.FieldError) string {
+	namespace := fe.Namespace()
+	if dot := strings.Index(namespace, "."); dot >= 0 {
+		return namespace[dot+1:]
+	}
+	return fe.Field()
+}
+
+// message returns the English message for a failed rule as a format string and its arguments.
+func message(fe validator.FieldError) (string, []interface{}) {
+	isString := fe.Kind() == reflect.String
+	param := []interface{}{fe.Param()}
+	switch fe.Tag() {
+	case "required", "required_without", "required_if":
+		return "is required", nil
+	case "notblank":
+		return "must not be blank", nil
+	case "max":
+		if isString {
+			return "must be at most %s characters", param
+		}
+		if fe.Kind() == reflect.Slice || fe.Kind() == reflect.Map {
+			return "must have at most %s items", param
+		}
+		return "must be at most %s", param
+	case "min":
+		if isString {
+			return "must be at least %s characters", param
+		}
+		return "must be at least %s", param
+	case "len":
+		if isString {
+			return "must be exactly %s characters", param
+		}
+		return "must have exactly %s items", param
+	case "gt":
+		return "must be greater than %s", param
+	case "gte":
+		return "must be at least %s", param
+	case "lt":
+		return "must be less than %s", param
+	case "lte":
+		return "must be at most %s", param
+	case "oneof":
+		return "must be one of: %s", []interface{}{strings.ReplaceAll(fe.Param(), " ", ", ")}
+	case "email":
+		return "must be a valid email address", nil
+	case "url", "http_url":
+		return "must be a valid URL", nil
+	case "numeric":
+		return "must contain only digits", nil
+	case "alphanum":
+		return "must contain only letters and digits", nil
+	case "phone":
+		return "must be 9 to 15 digits, optionally starting with +", nil
+	case "username":
+		return "must be 3 to 50 letters, digits, dots, dashes or underscores", nil
+	case "date":
+		return "must be a real date in YYYY-MM-DD format", nil
+	case "birthdate":
+		return "must be a real date in YYYY-MM-DD format, between 1900 and today", nil
+	case "language":
+		return "must be one of: %s", []interface{}{strings.Join(i18n.Supported(), ", ")}
+	}
+	return "is invalid", nil
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "object"
+}
+
+// ErrValidationFailed is the problem returned for invalid fields; its "errors" member lists them.
+var ErrValidationFailed = apierror.New(http.StatusUnprocessableEntity, apierror.CodeValidationFailed, "One or more fields are invalid")
+
+// Respond replies 422 with the list of invalid fields, their messages in the request's language.
+func Respond(c *gin.Context, fieldErrors []FieldError) {
+	localized := make([]FieldError, len(fieldErrors))
+	for i, fe := range fieldErrors {
+		fe.Message = i18n.T(c, fe.Message, fe.args...)
+		fe.args = nil
+		localized[i] = fe
+	}
+	apierror.Respond(c, ErrValidationFailed.With("errors", localized))
+}
+
+// RespondField replies 422 for one invalid field found after binding, e.g. by a check
+// that needs the database or the caller's role. message is English, formatted with args.
+func RespondField(c *gin.Context, field, rule, message string, args ...interface{}) {
+	Respond(c, []FieldError{{Field: field, Rule: rule, Message: message, args: args}})
+}
+
+// BindJSON decodes the JSON body into v and validates it. On failure it writes a
+// 400 (malformed JSON) or 422 (invalid fields) response and returns false.
+func BindJSON(c *gin.Context, v interface{}) bool {
+	setup()
+	err := c.ShouldBindJSON(v)
+	if err == nil {
+		return true
+	}
+	if fieldErrors := FromError(err); len(fieldErrors) > 0 {
+		Respond(c, fieldErrors)
+		return false
+	}
+
+	message := "Request body must be valid JSON"
+	if errors.Is(err, io.EOF) {
+		message = "Request body is required"
+	}
+	apierror.Respond(c, apierror.BadRequest(message))
+	return false
+}
@@ -1,34 +1,284 @@
 package websocket
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"order-notification-system/internal/apierror"
+	"order-notification-system/internal/auth"
+	"order-notification-system/internal/middleware"
+	"order-notification-system/internal/models"
 	"order-notification-system/internal/utils"
+	"strings"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+// Handler serves /ws using the policy in Config.
+type Handler struct {
+	DB       *gorm.DB
+	cfg      Config
+	upgrader websocket.Upgrader
+	limiter  *connectionLimiter
 }
 
-func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+// NewHandler creates a WebSocket Handler with the given policy.
+func NewHandler(db *gorm.DB, cfg Config) *Handler {
+	limiter := newConnectionLimiter(cfg.MaxConnections, cfg.MaxConnectionsPerUser, cfg.MaxPendingPerIP)
+	return &Handler{
+		DB:  db,
+		cfg: cfg,
+		upgrader: websocket.Upgrader{
+			CheckOrigin:       originChecker(cfg.AllowedOrigins, limiter),
+			EnableCompression: cfg.EnableCompression,
+			// Echo the "bearer" protocol back so browsers accept the handshake
+			Subprotocols: []string{middleware.WebSocketBearerProtocol},
+		},
+		limiter: limiter,
+	}
+}
+
+// CheckOrigin reports whether the handshake's Origin is allowed, as the upgrader will check it.
+// WebSocketAuthMiddleware calls it before redeeming credentials.
+func (h *Handler) CheckOrigin(r *http.Request) bool {
+	return h.upgrader.CheckOrigin(r)
+}
+
+// clientMessage is a message sent by an authenticated client.
+type clientMessage struct {
+	Type     string   `json:"type"`
+	Statuses []string `json:"statuses"`
+	Station  string   `json:"station"`
+}
+
+// authFrame is the first message a client sends when it did not authenticate during the handshake.
+type authFrame struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+}
+
+// HandleWebSocket upgrades the connection and registers the client for notifications.
+// WebSocketAuthMiddleware must run first; if it left no claims, the client has to
+// authenticate with an auth frame before Config.AuthTimeout. Until it does, the connection
+// counts against Config.MaxPendingPerIP instead of Config.MaxConnections, so anonymous
+// clients cannot fill the server.
+//
+// The client first receives a snapshot of the open orders matching its
+// subscription (?statuses=pending,preparing, default all open statuses) and
+// the active announcements for its station (?station=grill), followed by
+// order_created, order_status and announcements events. A client may send
+// {"type":"subscribe","statuses":[...],"station":"..."} at any time to
+// change its subscription and receive a fresh snapshot.
+func (h *Handler) HandleWebSocket(c *gin.Context) {
+	ip := c.ClientIP()
+	claims, authenticated := middleware.GetClaims(c)
+	if authenticated {
+		if !h.limiter.acquireSlot() {
+			log.Printf("Rejected WebSocket connection from %s: server connection limit reached", ip)
+			apierror.Respond(c, apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, "Too many WebSocket connections"))
+			return
+		}
+		defer h.limiter.releaseSlot()
+	} else if !h.limiter.acquirePending(ip) {
+		log.Printf("Rejected WebSocket connection from %s: too many unauthenticated connections", ip)
+		apierror.Respond(c, apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "Too many unauthenticated WebSocket connections"))
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		http.Error(w, "Could not upgrade connection", http.StatusBadRequest)
+		// Upgrade has already written the HTTP error response
+		if !authenticated {
+			h.limiter.releasePending(ip)
+		}
 		return
 	}
 	defer conn.Close()
+	conn.SetReadLimit(h.cfg.MaxMessageBytes)
+
+	if !authenticated {
+		claims, err = authenticateFirstMessage(conn, h.cfg.AuthTimeout)
+		h.limiter.releasePending(ip)
+		if err != nil {
+			h.limiter.reject(RejectAuthFailed)
+			log.Printf("WebSocket auth frame rejected from %s: %v", ip, err)
+			closeWithReason(conn, websocket.ClosePolicyViolation, "authentication required")
+			return
+		}
+		// Only authenticated connections take a place in the overall budget
+		if !h.limiter.acquireSlot() {
+			log.Printf("Rejected WebSocket connection for '%s': server connection limit reached", claims.Username)
+			closeWithReason(conn, websocket.CloseTryAgainLater, "too many connections")
+			return
+		}
+		defer h.limiter.releaseSlot()
+		if err := conn.WriteJSON(gin.H{"type": "auth_ok"}); err != nil {
+			return
+		}
+	}
+
+	if !h.limiter.acquireUser(claims.Username) {
+		log.Printf("Rejected WebSocket connection for '%s': per-user connection limit reached", claims.Username)
+		closeWithReason(conn, websocket.CloseTryAgainLater, "too many connections for this user")
+		return
+	}
+	defer h.limiter.releaseUser(claims.Username)
+	log.Printf("WebSocket client connected: %s", claims.Username)
+
+	subscription, err := parseSubscription(c.Query("statuses"), c.Query("station"))
+	if err != nil {
+		closeWithReason(conn, websocket.CloseUnsupportedData, err.Error())
+		return
+	}
+	canViewOrders := claims.Can(auth.PermViewOrders)
+	subscription = restrictSubscription(canViewOrders, subscription)
 
-	utils.RegisterClient(conn)
-	defer utils.UnregisterClient(conn)
+	client := utils.NewClient(conn, claims.Username, auth.NormalizeRole(claims.Role))
+	go client.WritePump()
+	defer utils.UnregisterClient(client)
+
+	if err := utils.Subscribe(client, subscription, h.loadSnapshot); err != nil {
+		log.Printf("Error loading WebSocket snapshot for '%s': %v", claims.Username, err)
+		closeWithReason(conn, websocket.CloseInternalServerErr, "could not load snapshot")
+		return
+	}
+	h.sendAnnouncements(client)
+	if count, err := models.CountUnreadNotifications(h.DB, claims.Username); err == nil {
+		utils.Send(client, utils.UnreadCountMessage(count))
+	}
 
 	for {
-		// Listen for messages from the client if needed
-		_, _, err := conn.ReadMessage()
+		// Listen for messages from the client
+		_, data, err := conn.ReadMessage()
 		if err != nil {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				h.limiter.reject(RejectMessageLimit)
+				log.Printf("WebSocket client '%s' exceeded the %d byte message limit", claims.Username, h.cfg.MaxMessageBytes)
+			}
 			break
 		}
+		h.handleClientMessage(client, canViewOrders, data)
 	}
 }
+
+// errorMessage is the in-band reply to a client message that could not be handled.
+// Its code is one of the HTTP API's error codes.
+func errorMessage(code apierror.Code, message string) gin.H {
+	return gin.H{"type": "error", "code": code, "message": message}
+}
+
+func (h *Handler) handleClientMessage(client *utils.Client, canViewOrders bool, data []byte) {
+	var message clientMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		utils.Send(client, errorMessage(apierror.CodeBadRequest, "Invalid JSON message"))
+		return
+	}
+
+	switch message.Type {
+	case "subscribe":
+		subscription, err := parseSubscription(strings.Join(message.Statuses, ","), message.Station)
+		if err != nil {
+			utils.Send(client, errorMessage(apierror.CodeValidationFailed, err.Error()))
+			return
+		}
+		subscription = restrictSubscription(canViewOrders, subscription)
+		if err := utils.Subscribe(client, subscription, h.loadSnapshot); err != nil {
+			log.Printf("Error loading WebSocket snapshot for '%s': %v", client.Username, err)
+			utils.Send(client, errorMessage(apierror.CodeInternal, "Could not load snapshot"))
+			return
+		}
+		h.sendAnnouncements(client)
+	default:
+		utils.Send(client, errorMessage(apierror.CodeBadRequest, "Unknown message type"))
+	}
+}
+
+// restrictSubscription removes the order feed for callers that may not view orders (customers,
+// API keys without the orders:view scope), who still receive their own notifications and announcements.
+func restrictSubscription(canViewOrders bool, subscription utils.Subscription) utils.Subscription {
+	if !canViewOrders {
+		subscription.Statuses = []string{}
+	}
+	return subscription
+}
+
+// loadSnapshot returns the orders currently in the subscribed statuses.
+func (h *Handler) loadSnapshot(subscription utils.Subscription) ([]models.Order, error) {
+	if len(subscription.Statuses) == 0 {
+		return []models.Order{}, nil
+	}
+	return models.GetOrdersByStatus(h.DB, subscription.Statuses)
+}
+
+// sendAnnouncements sends the active announcements addressed to the client, so late joiners see them too.
+func (h *Handler) sendAnnouncements(client *utils.Client) {
+	announcements, err := models.GetActiveAnnouncements(h.DB, client.Username)
+	if err != nil {
+		log.Printf("Error loading announcements for '%s': %v", client.Username, err)
+		return
+	}
+	utils.Send(client, utils.AnnouncementsMessage(utils.ActiveAnnouncementsFor(client, announcements)))
+}
+
+// parseSubscription builds a subscription from a comma-separated status list, defaulting to all open statuses.
+func parseSubscription(raw string, station string) (utils.Subscription, error) {
+	var statuses []string
+	for _, status := range strings.Split(raw, ",") {
+		status = strings.ToLower(strings.TrimSpace(status))
+		if status == "" {
+			continue
+		}
+		if !models.IsValidOrderStatus(status) {
+			return utils.Subscription{}, fmt.Errorf("unknown order status %q", status)
+		}
+		statuses = append(statuses, status)
+	}
+	if len(statuses) == 0 {
+		statuses = models.OpenOrderStatuses
+	}
+	return utils.Subscription{Statuses: statuses, Station: strings.ToLower(strings.TrimSpace(station))}, nil
+}
+
+// Stats returns current connection counts and rejection counters.
+func (h *Handler) Stats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": h.limiter.stats()})
+}
+
+// authenticateFirstMessage waits up to timeout for {"type":"auth","token":"..."} and verifies the token.
+func authenticateFirstMessage(conn *websocket.Conn, timeout time.Duration) (*auth.CustomClaims, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	var frame authFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return nil, errors.New("first message is not a valid auth frame")
+	}
+	if frame.Type != "auth" || frame.Token == "" {
+		return nil, errors.New("first message must be an auth frame with a token")
+	}
+
+	claims, err := middleware.AuthenticateToken(frame.Token)
+	if err != nil {
+		return nil, err
+	}
+	// Clear the deadline for the rest of the session
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func closeWithReason(conn *websocket.Conn, code int, reason string) {
+	deadline := time.Now().Add(time.Second)
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+}
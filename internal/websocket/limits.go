@@ -0,0 +1,201 @@
+package websocket
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"order-notification-system/internal/config"
+)
+
+// Rejection reasons reported by Handler.Stats.
+const (
+	RejectOrigin       = "origin"
+	RejectServerFull   = "server_full"
+	RejectUserLimit    = "user_limit"
+	RejectPendingLimit = "pending_limit"
+	RejectAuthFailed   = "auth_failed"
+	RejectMessageLimit = "message_too_large"
+)
+
+// Config holds the upgrader policy.
+type Config struct {
+	// AllowedOrigins lists origins (scheme://host[:port]) allowed to connect.
+	// "*" allows any origin; an empty list only allows same-host requests.
+	AllowedOrigins []string
+	// MaxConnections caps concurrent connections overall; 0 means unlimited.
+	MaxConnections int
+	// MaxConnectionsPerUser caps concurrent connections per username; 0 means unlimited.
+	MaxConnectionsPerUser int
+	// MaxPendingPerIP caps connections per client IP still waiting to send their auth frame; 0 means unlimited.
+	// They do not count towards MaxConnections until they authenticate.
+	MaxPendingPerIP int
+	// MaxMessageBytes is the largest message accepted from a client.
+	MaxMessageBytes int64
+	// EnableCompression negotiates permessage-deflate when the client offers it.
+	EnableCompression bool
+	// AuthTimeout is how long an unauthenticated client has to send its auth frame.
+	AuthTimeout time.Duration
+}
+
+// LoadConfig reads the WebSocket policy from environment variables.
+func LoadConfig() Config {
+	return Config{
+		AllowedOrigins:        config.GetEnvList("WS_ALLOWED_ORIGINS"),
+		MaxConnections:        config.GetEnvInt("WS_MAX_CONNECTIONS", 1000),
+		MaxConnectionsPerUser: config.GetEnvInt("WS_MAX_CONNECTIONS_PER_USER", 5),
+		MaxPendingPerIP:       config.GetEnvInt("WS_MAX_PENDING_PER_IP", 3),
+		MaxMessageBytes:       int64(config.GetEnvInt("WS_MAX_MESSAGE_BYTES", 4096)),
+		EnableCompression:     config.GetEnvBool("WS_ENABLE_COMPRESSION", false),
+		AuthTimeout:           config.GetEnvDuration("WS_AUTH_TIMEOUT", 10*time.Second),
+	}
+}
+
+// connectionLimiter tracks open connections and counts rejected attempts.
+type connectionLimiter struct {
+	mu         sync.Mutex
+	maxTotal   int
+	maxPerUser int
+	maxPending int
+	total      int
+	perUser    map[string]int
+	pending    map[string]int // client IP -> connections waiting for their auth frame
+	rejections map[string]uint64
+}
+
+func newConnectionLimiter(maxTotal, maxPerUser, maxPending int) *connectionLimiter {
+	return &connectionLimiter{
+		maxTotal:   maxTotal,
+		maxPerUser: maxPerUser,
+		maxPending: maxPending,
+		perUser:    make(map[string]int),
+		pending:    make(map[string]int),
+		rejections: make(map[string]uint64),
+	}
+}
+
+// acquireSlot reserves a place in the overall connection budget.
+func (l *connectionLimiter) acquireSlot() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxTotal > 0 && l.total >= l.maxTotal {
+		l.rejections[RejectServerFull]++
+		return false
+	}
+	l.total++
+	return true
+}
+
+func (l *connectionLimiter) releaseSlot() {
+	l.mu.Lock()
+	l.total--
+	l.mu.Unlock()
+}
+
+// acquireUser reserves a per-user connection once the username is known.
+func (l *connectionLimiter) acquireUser(username string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxPerUser > 0 && l.perUser[username] >= l.maxPerUser {
+		l.rejections[RejectUserLimit]++
+		return false
+	}
+	l.perUser[username]++
+	return true
+}
+
+func (l *connectionLimiter) releaseUser(username string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.perUser[username] <= 1 {
+		delete(l.perUser, username)
+		return
+	}
+	l.perUser[username]--
+}
+
+// acquirePending reserves a place for an unauthenticated connection from ip.
+func (l *connectionLimiter) acquirePending(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxPending > 0 && l.pending[ip] >= l.maxPending {
+		l.rejections[RejectPendingLimit]++
+		return false
+	}
+	l.pending[ip]++
+	return true
+}
+
+func (l *connectionLimiter) releasePending(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pending[ip] <= 1 {
+		delete(l.pending, ip)
+		return
+	}
+	l.pending[ip]--
+}
+
+func (l *connectionLimiter) reject(reason string) {
+	l.mu.Lock()
+	l.rejections[reason]++
+	l.mu.Unlock()
+}
+
+// Stats is a snapshot of connection usage and rejection counters.
+type Stats struct {
+	Connections int `json:"connections"`
+	Users       int `json:"users"`
+	// Pending counts connections still waiting for their auth frame
+	Pending    int               `json:"pending"`
+	Rejections map[string]uint64 `json:"rejections"`
+}
+
+func (l *connectionLimiter) stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rejections := make(map[string]uint64, len(l.rejections))
+	for reason, count := range l.rejections {
+		rejections[reason] = count
+	}
+	pending := 0
+	for _, count := range l.pending {
+		pending += count
+	}
+	return Stats{Connections: l.total, Users: len(l.perUser), Pending: pending, Rejections: rejections}
+}
+
+// originChecker builds an upgrader CheckOrigin func from the allowlist.
+func originChecker(allowed []string, limiter *connectionLimiter) func(r *http.Request) bool {
+	allowAll := false
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, origin := range allowed {
+		if origin == "*" {
+			allowAll = true
+		}
+		allowedSet[strings.ToLower(strings.TrimRight(origin, "/"))] = true
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || allowAll {
+			// Non-browser clients (POS terminals, scripts) do not send Origin
+			return true
+		}
+		if allowedSet[strings.ToLower(origin)] {
+			return true
+		}
+		if len(allowedSet) == 0 {
+			// No allowlist configured: fall back to a same-host check
+			if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+				return true
+			}
+		}
+		limiter.reject(RejectOrigin)
+		log.Printf("Rejected WebSocket origin %q from %s", origin, r.RemoteAddr)
+		return false
+	}
+}